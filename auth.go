@@ -0,0 +1,427 @@
+package psfacade
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Principal is an authenticated client and the roles it holds.
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+// HasRole reports whether the principal holds the role.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the client making a request. It returns a nil
+// Principal and nil error when the request carries no credentials that it
+// handles, so that several authenticators can be tried in turn.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+var errBadCredentials = errors.New("invalid credentials")
+
+// APIKey is a static key given to a client application.
+type APIKey struct {
+	Key   string
+	Roles []string
+}
+
+// APIKeys authenticates requests by the X-API-Key header. The map key is the
+// name of the client holding the APIKey. For clients such as CalDAV
+// calendars that can send nothing else, the key may instead be the password
+// of HTTP Basic authentication with the client name as the user name.
+type APIKeys map[string]APIKey
+
+// Authenticate implements Authenticator.
+func (keys APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	if name, password, ok := r.BasicAuth(); ok {
+		key, found := keys[name]
+		if !found || subtle.ConstantTimeCompare([]byte(password), []byte(key.Key)) != 1 {
+			return nil, errBadCredentials
+		}
+		return &Principal{Name: name, Roles: key.Roles}, nil
+	}
+	given := r.Header.Get("X-API-Key")
+	if given == "" {
+		return nil, nil
+	}
+	for name, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key.Key)) == 1 {
+			return &Principal{Name: name, Roles: key.Roles}, nil
+		}
+	}
+	return nil, errBadCredentials
+}
+
+// SignedRole is the role held by a request for a correctly signed URL.
+const SignedRole = "signed"
+
+// URLSigner authenticates requests whose sig parameter is the HMAC of the
+// URL path, so that a calendar feed URL cannot be derived from the loginid
+// or room alone.
+type URLSigner struct {
+	Key []byte
+}
+
+func (s URLSigner) signature(path string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(path))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the path with the sig parameter that authenticates it.
+func (s URLSigner) Sign(path string) string {
+	return path + "?sig=" + s.signature(path)
+}
+
+// Authenticate implements Authenticator. The principal is valid only for
+// the signed path.
+func (s URLSigner) Authenticate(r *http.Request) (*Principal, error) {
+	sig := r.URL.Query().Get("sig")
+	if sig == "" {
+		return nil, nil
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(r.URL.Path))) {
+		return nil, errBadCredentials
+	}
+	return &Principal{Name: r.URL.Path, Roles: []string{SignedRole}}, nil
+}
+
+// JWTValidator authenticates requests carrying a bearer JSON Web Token
+// signed with either HS256 (using Secret) or RS256 (using PublicKey).
+type JWTValidator struct {
+	Secret     []byte
+	PublicKey  *rsa.PublicKey
+	Issuer     string // if set, the required iss claim
+	Audience   string // if set, a required aud value
+	RolesClaim string // claim holding the roles, either a list or a space-separated string
+}
+
+// Authenticate implements Authenticator.
+func (v JWTValidator) Authenticate(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, nil
+	}
+	return v.Validate(strings.TrimPrefix(auth, "Bearer "), time.Now())
+}
+
+// Validate checks the token's signature and claims as of the given time and
+// returns the principal it names.
+func (v JWTValidator) Validate(token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %v", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && v.Secret != nil:
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errBadCredentials
+		}
+	case header.Alg == "RS256" && v.PublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(v.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, errBadCredentials
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); !ok || now.Unix() >= int64(exp) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return nil, errors.New("token not yet valid")
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return nil, errors.New("token issuer mismatch")
+	}
+	if v.Audience != "" && !claimHas(claims["aud"], v.Audience) {
+		return nil, errors.New("token audience mismatch")
+	}
+	p := &Principal{}
+	p.Name, _ = claims["sub"].(string)
+	switch roles := claims[v.RolesClaim].(type) {
+	case string:
+		p.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("malformed token: %v", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("malformed token: %v", err)
+	}
+	return nil
+}
+
+// claimHas reports whether the claim, a string or list of strings, includes value.
+func claimHas(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []interface{}:
+		for _, item := range c {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AnonymousRole allows unauthenticated requests in a RouteRule, and
+// AnyRole allows any authenticated request.
+const (
+	AnonymousRole = "anonymous"
+	AnyRole       = "*"
+)
+
+// RouteRule gives the roles allowed to request paths starting with Prefix,
+// matching whole path segments: "/students" matches "/students/123" but not
+// "/studentsX".
+type RouteRule struct {
+	Prefix string
+	Roles  []string
+}
+
+// Auth authenticates requests and authorizes them according to the route
+// rules. The first rule whose prefix matches the request path applies; a
+// request matching no rule is refused.
+type Auth struct {
+	Authenticators []Authenticator
+	Routes         []RouteRule
+	AllowedOrigins []string // origins allowed cross-origin access
+}
+
+// AuthConfig is the auth configuration file format.
+type AuthConfig struct {
+	APIKeys       APIKeys
+	URLSigningKey string
+	JWT           *struct {
+		Secret        string
+		PublicKeyFile string // PEM file of the RSA public key
+		Issuer        string
+		Audience      string
+		RolesClaim    string
+	}
+	Routes         []RouteRule
+	AllowedOrigins []string
+}
+
+// GetAuth reads the auth configuration file and returns the Auth it defines.
+func GetAuth(filename string) *Auth {
+	authfile, err := os.Open(filename)
+	if err != nil {
+		log.Panicf("cannot open auth config file (%v)", filename)
+	}
+	defer authfile.Close()
+	log.Printf("Reading %s for auth config", filename)
+	decoder := json.NewDecoder(authfile)
+	config := AuthConfig{}
+	jerr := decoder.Decode(&config)
+	if jerr != nil {
+		log.Panicf("Cannot decode json file %v: %v", filename, jerr)
+	}
+
+	a := &Auth{Routes: config.Routes, AllowedOrigins: config.AllowedOrigins}
+	if len(config.APIKeys) > 0 {
+		a.Authenticators = append(a.Authenticators, config.APIKeys)
+	}
+	if config.URLSigningKey != "" {
+		a.Authenticators = append(a.Authenticators, URLSigner{Key: []byte(config.URLSigningKey)})
+	}
+	if jc := config.JWT; jc != nil {
+		v := JWTValidator{Issuer: jc.Issuer, Audience: jc.Audience, RolesClaim: jc.RolesClaim}
+		if jc.Secret != "" {
+			v.Secret = []byte(jc.Secret)
+		}
+		if jc.PublicKeyFile != "" {
+			v.PublicKey = readRSAPublicKey(jc.PublicKeyFile)
+		}
+		if v.RolesClaim == "" {
+			v.RolesClaim = "roles"
+		}
+		a.Authenticators = append(a.Authenticators, v)
+	}
+	return a
+}
+
+func readRSAPublicKey(filename string) *rsa.PublicKey {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Panicf("cannot read public key file (%v)", filename)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		log.Panicf("no PEM data in public key file %v", filename)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		log.Panicf("cannot parse public key file %v: %v", filename, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		log.Panicf("public key in %v is not an RSA key", filename)
+	}
+	return rsaKey
+}
+
+// Signer returns the URLSigner among the authenticators, if any.
+func (a *Auth) Signer() (URLSigner, bool) {
+	for _, au := range a.Authenticators {
+		if s, ok := au.(URLSigner); ok {
+			return s, true
+		}
+	}
+	return URLSigner{}, false
+}
+
+// challenges returns the WWW-Authenticate challenges of the authenticators
+// that clients can answer: Bearer for JWTs and Basic for API keys.
+func (a *Auth) challenges() []string {
+	var challenges []string
+	for _, au := range a.Authenticators {
+		switch au.(type) {
+		case JWTValidator:
+			challenges = append(challenges, "Bearer")
+		case APIKeys:
+			challenges = append(challenges, `Basic realm="psfacade"`)
+		}
+	}
+	return challenges
+}
+
+// Authenticate tries each authenticator in turn, returning the first
+// principal found. Invalid credentials are an error even if a later
+// authenticator might accept the request.
+func (a *Auth) Authenticate(r *http.Request) (*Principal, error) {
+	for _, au := range a.Authenticators {
+		p, err := au.Authenticate(r)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+// matches reports whether the path is the rule's prefix or lies under it.
+func (rule RouteRule) matches(path string) bool {
+	prefix := strings.TrimSuffix(rule.Prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Allowed reports whether the principal (nil if anonymous) may request the path.
+func (a *Auth) Allowed(p *Principal, path string) bool {
+	for _, rule := range a.Routes {
+		if !rule.matches(path) {
+			continue
+		}
+		for _, role := range rule.Roles {
+			if role == AnonymousRole || (p != nil && (role == AnyRole || p.HasRole(role))) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// AllowedOrigin reports whether the origin may make cross-origin requests.
+func (a *Auth) AllowedOrigin(origin string) bool {
+	for _, o := range a.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal stored in the context by Auth.Handler,
+// or nil for an anonymous request.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Handler wraps next so that it receives only authorized requests, with the
+// principal available through PrincipalFrom.
+func (a *Auth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			log.Printf("authentication failed for %v from %v: %v", r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, "authentication failed", http.StatusUnauthorized)
+			return
+		}
+		if !a.Allowed(p, r.URL.Path) {
+			if p == nil {
+				for _, challenge := range a.challenges() {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "forbidden", http.StatusForbidden)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
@@ -0,0 +1,95 @@
+package psfacade
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeHS256Token(secret, claims string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTValidator(t *testing.T) {
+	v := JWTValidator{Secret: []byte("s3cret"), Issuer: "sso", RolesClaim: "roles"}
+	now := time.Unix(1700000000, 0)
+
+	token := makeHS256Token("s3cret", `{"sub":"fogel","iss":"sso","exp":1700000100,"roles":["staff"]}`)
+	p, err := v.Validate(token, now)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.Name != "fogel" || !p.HasRole("staff") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	if _, err := v.Validate(token, now.Add(time.Hour)); err == nil {
+		t.Errorf("expired token accepted")
+	}
+	if _, err := v.Validate(makeHS256Token("wrong", `{"iss":"sso","exp":1700000100}`), now); err == nil {
+		t.Errorf("token with bad signature accepted")
+	}
+	if _, err := v.Validate(makeHS256Token("s3cret", `{"iss":"other","exp":1700000100}`), now); err == nil {
+		t.Errorf("token from wrong issuer accepted")
+	}
+}
+
+func TestAuthRoutes(t *testing.T) {
+	signer := URLSigner{Key: []byte("k")}
+	a := &Auth{
+		Authenticators: []Authenticator{APIKeys{"app": {Key: "abc", Roles: []string{"registrar"}}}, signer},
+		Routes: []RouteRule{
+			{Prefix: "/pscal/cal", Roles: []string{AnonymousRole}},
+			{Prefix: "/pscal/u/", Roles: []string{SignedRole}},
+			{Prefix: "/students", Roles: []string{"registrar"}},
+		},
+	}
+	tests := []struct {
+		url    string
+		apikey string
+		basic  string // user:password
+		ok     bool
+	}{
+		{"/pscal/cal", "", "", true},
+		{"/pscal/u/fogel", "", "", false},
+		{signer.Sign("/pscal/u/fogel"), "", "", true},
+		{signer.Sign("/pscal/u/fogel") + "x", "", "", false},
+		{"/students", "", "", false},
+		{"/students", "abc", "", true},
+		{"/students", "abd", "", false},
+		{"/students", "", "app:abc", true},
+		{"/students", "", "other:abc", false},
+		{"/students/123", "abc", "", true},
+		{"/studentsX", "abc", "", false},
+		{"/other", "abc", "", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.apikey != "" {
+			r.Header.Set("X-API-Key", test.apikey)
+		}
+		if user, password, ok := strings.Cut(test.basic, ":"); ok {
+			r.SetBasicAuth(user, password)
+		}
+		p, err := a.Authenticate(r)
+		ok := err == nil && a.Allowed(p, r.URL.Path)
+		if ok != test.ok {
+			t.Errorf("%v (key %q): allowed = %v, expected %v", test.url, test.apikey, ok, test.ok)
+		}
+	}
+	// only the configured authenticators are offered as challenges
+	w := httptest.NewRecorder()
+	a.Handler(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/students", nil))
+	if got := w.Header().Values("WWW-Authenticate"); w.Code != http.StatusUnauthorized || len(got) != 1 || !strings.HasPrefix(got[0], "Basic ") {
+		t.Errorf("challenges %q with status %d", got, w.Code)
+	}
+}
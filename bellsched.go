@@ -0,0 +1,149 @@
+package psfacade
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// BellPeriod is one period of a day's bell schedule.
+type BellPeriod struct {
+	Number       int       `json:"period"`
+	Name         string    `json:"name"`
+	Abbreviation string    `json:"abbreviation"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+// BellSchedule is the bell schedule of one calendar day, its periods in
+// order of start time.
+type BellSchedule struct {
+	Date     time.Time    `json:"date"`
+	Name     string       `json:"name"`
+	CycleDay string       `json:"cycle_day"`
+	Periods  []BellPeriod `json:"periods"`
+}
+
+// GetBellSchedule returns the bell schedule of the date, or false if the
+// date has none in the school calendar.
+func GetBellSchedule(db *sql.DB, date time.Time) (BellSchedule, bool) {
+	schedules := getBellSchedules(db, date, date, "")
+	if len(schedules) == 0 {
+		return BellSchedule{}, false
+	}
+	return schedules[0], true
+}
+
+// GetBellSchedules returns the bell schedules of the days in session in
+// the school year, in date order.
+func GetBellSchedules(db *sql.DB) []BellSchedule {
+	year := currentYearTerm(db)
+	return getBellSchedules(db, year.FirstDay, year.LastDay, " and cd.insession = 1")
+}
+
+// getBellSchedules returns the bell schedules of the days from the date from
+// through the date to, limited by the extra condition.
+func getBellSchedules(db *sql.DB, from, to time.Time, condition string) []BellSchedule {
+	query := `
+select to_char(cd.date_value, 'YYYY-MM-DD'), bs.name, cyd.abbreviation,
+p.period_number, p.name, p.abbreviation, bsi.start_time, bsi.end_time
+from calendar_day cd
+join bell_schedule bs on cd.bell_schedule_id = bs.id
+join bell_schedule_items bsi on bsi.bell_schedule_id = bs.id
+join period p on bsi.period_id = p.id
+left outer join cycle_day cyd on cd.cycle_day_id = cyd.id
+where cd.schoolid = 140177
+and cd.date_value between to_date(:from, 'YYYY-MM-DD') and to_date(:to, 'YYYY-MM-DD')` + condition + `
+order by cd.date_value, bsi.start_time, p.period_number
+`
+	args := []interface{}{from.Format("2006-01-02"), to.Format("2006-01-02")}
+	if os.Getenv("CALENDAR_DEBUG") != "" {
+		log.Println("args", args, "query", query)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	defer rows.Close()
+	loc, err := time.LoadLocation(calTimezoneID)
+	if err != nil {
+		log.Panicf("LoadLocation failed: %v", err)
+	}
+
+	var schedules []BellSchedule
+	for rows.Next() {
+		var date string
+		var name, cycleDay, periodName, periodAbbr sql.NullString
+		var period BellPeriod
+		var start, end int // seconds after midnight
+		err = rows.Scan(&date, &name, &cycleDay, &period.Number, &periodName, &periodAbbr, &start, &end)
+		if err != nil {
+			log.Panic("rows.Scan: ", err)
+		}
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			log.Panic("time.Parse ", err)
+		}
+		if n := len(schedules); n == 0 || !schedules[n-1].Date.Equal(day) {
+			schedules = append(schedules, BellSchedule{Date: day, Name: emptyifnull(name), CycleDay: emptyifnull(cycleDay)})
+		}
+		period.Name = emptyifnull(periodName)
+		period.Abbreviation = emptyifnull(periodAbbr)
+		period.Start = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, start, 0, loc)
+		period.End = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, end, 0, loc)
+		sched := &schedules[len(schedules)-1]
+		sched.Periods = append(sched.Periods, period)
+	}
+	if err := rows.Err(); err != nil {
+		log.Panic("rows.Err ", err)
+	}
+	return schedules
+}
+
+// Period returns the period under way at t, or false if there is none.
+func (bs BellSchedule) Period(t time.Time) (BellPeriod, bool) {
+	for _, p := range bs.Periods {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return p, true
+		}
+	}
+	return BellPeriod{}, false
+}
+
+// BellScheduleFeed returns the Feed of the periods of the bell schedules
+// of the school year's days in session, each period an event.
+func BellScheduleFeed(db *sql.DB) Feed {
+	return bellScheduleFeed(GetBellSchedules(db))
+}
+
+func bellScheduleFeed(schedules []BellSchedule) Feed {
+	feed := Feed{
+		ProdID:      "-//imsa.edu//powerschool bell schedule//EN",
+		Name:        "IMSA Bell Schedule",
+		Description: "Periods of the IMSA PowerSchool bell schedules",
+		Stamp:       time.Now(),
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for _, sched := range schedules {
+			for _, p := range sched.Periods {
+				summary := p.Name
+				if summary == "" {
+					summary = fmt.Sprintf("Period %d", p.Number)
+				}
+				events <- Event{
+					UID:         fmt.Sprintf("PS-Bell-%s-%d@imsa.edu", sched.Date.Format("20060102"), p.Number),
+					Start:       p.Start,
+					End:         p.End,
+					Summary:     summary,
+					Description: fmt.Sprintf("Bell Schedule: %s\nCycle Day: %s\n", sched.Name, sched.CycleDay),
+				}
+			}
+		}
+	}()
+	feed.Events = events
+	return feed
+}
@@ -0,0 +1,38 @@
+package psfacade
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBellSchedule(t *testing.T) {
+	loc, err := time.LoadLocation(calTimezoneID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, min int) time.Time { return time.Date(2016, 9, 6, hour, min, 0, 0, loc) }
+	sched := BellSchedule{
+		Date:     time.Date(2016, 9, 6, 0, 0, 0, 0, time.UTC),
+		Name:     "Regular",
+		CycleDay: "A",
+		Periods: []BellPeriod{
+			{Number: 1, Name: "Mod 1", Start: at(8, 0), End: at(8, 50)},
+			{Number: 2, Start: at(9, 0), End: at(9, 50)},
+		},
+	}
+	if p, ok := sched.Period(at(8, 50)); ok {
+		t.Errorf("Period(8:50) = %v, expected none", p.Number)
+	}
+	if p, ok := sched.Period(at(9, 10)); !ok || p.Number != 2 {
+		t.Errorf("Period(9:10) = %v, %v", p.Number, ok)
+	}
+
+	data := writeFeed(t, bellScheduleFeed([]BellSchedule{sched}))
+	checkICalendar(t, data)
+	for _, want := range []string{"SUMMARY:Mod 1", "SUMMARY:Period 2", "UID:PS-Bell-20160906-2@imsa.edu"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("feed lacks %q", want)
+		}
+	}
+}
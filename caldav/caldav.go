@@ -0,0 +1,303 @@
+// Package caldav serves the PowerSchool teacher and room calendars as
+// read-only CalDAV (RFC 4791) collections, with sync-collection (RFC 6578)
+// support so that clients fetch only the events that changed.
+//
+// Under the handler's prefix, {prefix}u/{loginid}/ is the calendar of a
+// teacher and {prefix}r/{room}/ that of a room. Each event is a resource in
+// its collection named for its UID. The prefix itself is the principal and
+// calendar home of every client, holding the calendars that the Backend
+// gives the authenticated client, such as a teacher's own calendar, so that
+// clients discover them through calendar-home-set.
+//
+// The package is also a CalDAV client: Sync writes a calendar's events into
+// a collection on another server, such as a teacher's own calendar.
+package caldav
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/fredcy/psfacade"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend supplies the calendars that a Handler serves.
+type Backend interface {
+	// Calendar returns the feed of the calendar of the given kind, "u" for
+	// a teacher or "r" for a room, and name. It returns false if there is
+	// no such calendar.
+	Calendar(kind, name string) (psfacade.Feed, bool)
+
+	// Home returns the calendars in the calendar home of the principal,
+	// which is nil for an anonymous client.
+	Home(principal *psfacade.Principal) []CalendarID
+}
+
+// CalendarID names a calendar of a Backend by its kind and name.
+type CalendarID struct {
+	Kind, Name string
+}
+
+// DBBackend is the Backend of the teacher and room schedules in PowerSchool.
+type DBBackend struct {
+	DB *sql.DB
+}
+
+// Calendar implements Backend.
+func (b DBBackend) Calendar(kind, name string) (psfacade.Feed, bool) {
+	switch kind {
+	case "u":
+		return psfacade.TeacherFeed(b.DB, name), true
+	case "r":
+		rooms, err := psfacade.GetRoomNames(b.DB)
+		if err != nil || !slices.Contains(rooms, name) {
+			return psfacade.Feed{}, false
+		}
+		return psfacade.RoomFeed(b.DB, name), true
+	}
+	return psfacade.Feed{}, false
+}
+
+// Home implements Backend. A principal named by a teacher's loginid has the
+// teacher's calendar.
+func (b DBBackend) Home(principal *psfacade.Principal) []CalendarID {
+	if principal == nil {
+		return nil
+	}
+	var home []CalendarID
+	for t := range psfacade.GetTeachers(b.DB) {
+		if t.LoginID == principal.Name {
+			home = append(home, CalendarID{Kind: "u", Name: t.LoginID})
+		}
+	}
+	return home
+}
+
+// maxSnapshots is how many past states of each collection the handler
+// remembers for sync-collection, and maxCollections how many collections.
+const (
+	maxSnapshots   = 20
+	maxCollections = 2000
+)
+
+// Handler is the http.Handler of the CalDAV service.
+type Handler struct {
+	Prefix  string // URL path at which the handler is mounted, ending in "/"
+	Backend Backend
+
+	mu        sync.Mutex
+	snapshots map[string][]snapshot // past states by collection href, oldest first
+}
+
+// snapshot is the state of a collection as of a sync token.
+type snapshot struct {
+	token string
+	etags map[string]string // by event href
+}
+
+// NewHandler returns a Handler for the backend mounted at prefix.
+func NewHandler(prefix string, backend Backend) *Handler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Handler{Prefix: prefix, Backend: backend, snapshots: map[string][]snapshot{}}
+}
+
+// target is the resource named by a request path.
+type target struct {
+	kind, name string // both empty for the root
+	resource   string // event resource name, empty for a collection
+}
+
+// parsePath returns the target of the path, or false if the path names nothing.
+func (h *Handler) parsePath(path string) (target, bool) {
+	rest, ok := strings.CutPrefix(path, h.Prefix)
+	if !ok {
+		if path+"/" == h.Prefix {
+			return target{}, true
+		}
+		return target{}, false
+	}
+	if rest == "" {
+		return target{}, true
+	}
+	kind, rest, _ := strings.Cut(rest, "/")
+	if kind != "u" && kind != "r" {
+		return target{}, false
+	}
+	t := target{kind: kind}
+	if strings.HasSuffix(rest, ".ics") {
+		i := strings.LastIndex(rest, "/")
+		if i < 0 {
+			return target{}, false
+		}
+		rest, t.resource = rest[:i], rest[i+1:]
+	}
+	t.name = strings.TrimSuffix(rest, "/")
+	return t, t.name != ""
+}
+
+// collectionHref returns the href of the collection of the kind and name.
+func (h *Handler) collectionHref(kind, name string) string {
+	return h.Prefix + kind + "/" + url.PathEscape(name) + "/"
+}
+
+// collection is a calendar read from the backend.
+type collection struct {
+	href   string
+	feed   psfacade.Feed // without its events, which are in events
+	events []psfacade.Event
+	hrefs  []string          // of the events, in order
+	etags  map[string]string // by event href
+	byHref map[string]psfacade.Event
+	token  string
+}
+
+// load reads the calendar from the backend and records its state for sync-collection.
+func (h *Handler) load(t target) (*collection, bool) {
+	feed, ok := h.Backend.Calendar(t.kind, t.name)
+	if !ok {
+		return nil, false
+	}
+	c := &collection{
+		href:   h.collectionHref(t.kind, t.name),
+		etags:  map[string]string{},
+		byHref: map[string]psfacade.Event{},
+	}
+	for ev := range feed.Events {
+		href := c.eventHref(ev.UID)
+		if _, dup := c.byHref[href]; dup {
+			continue
+		}
+		c.events = append(c.events, ev)
+		c.hrefs = append(c.hrefs, href)
+		c.etags[href] = `"` + ev.ContentHash() + `"`
+		c.byHref[href] = ev
+	}
+	feed.Events = nil
+	c.feed = feed
+	c.token = syncToken(c.etags)
+	h.remember(c)
+	return c, true
+}
+
+// syncToken returns the sync token of a collection whose events have the
+// etags. It depends only on the events, so it survives a server restart.
+func syncToken(etags map[string]string) string {
+	hrefs := make([]string, 0, len(etags))
+	for href := range etags {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+	hash := sha256.New()
+	for _, href := range hrefs {
+		hash.Write([]byte(href + " " + etags[href] + "\n"))
+	}
+	return "urn:psfacade:sync:" + hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// remember records the collection's state under its sync token.
+func (h *Handler) remember(c *collection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	past := h.snapshots[c.href]
+	if n := len(past); n > 0 && past[n-1].token == c.token {
+		return
+	}
+	if _, known := h.snapshots[c.href]; !known && len(h.snapshots) >= maxCollections {
+		h.snapshots = map[string][]snapshot{}
+	}
+	past = append(past, snapshot{c.token, c.etags})
+	if len(past) > maxSnapshots {
+		past = past[len(past)-maxSnapshots:]
+	}
+	h.snapshots[c.href] = past
+}
+
+// since returns the event etags of the collection as of the sync token, or
+// false if the token is unknown.
+func (h *Handler) since(href, token string) (map[string]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.snapshots[href] {
+		if s.token == token {
+			return s.etags, true
+		}
+	}
+	return nil, false
+}
+
+// eventCalendar returns the iCalendar of the collection holding just the event.
+func (c *collection) eventCalendar(ev psfacade.Event) []byte {
+	var buf bytes.Buffer
+	psfacade.WriteICalendarEvent(&buf, c.feed, ev, nil) // cannot fail, the event has a UID
+	return buf.Bytes()
+}
+
+const allowedMethods = "OPTIONS, GET, HEAD, PROPFIND, REPORT"
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.parsePath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", allowedMethods)
+	case "GET", "HEAD":
+		h.get(w, r, t)
+	case "PROPFIND":
+		h.propfind(w, r, t)
+	case "REPORT":
+		h.report(w, r, t)
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "calendars are read-only", http.StatusMethodNotAllowed)
+	}
+}
+
+// get serves a whole calendar or one event as iCalendar.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, t target) {
+	if t.kind == "" {
+		http.Error(w, "not a calendar", http.StatusMethodNotAllowed)
+		return
+	}
+	if t.resource == "" {
+		feed, ok := h.Backend.Calendar(t.kind, t.name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", psfacade.ICalendarContentType+"; charset=utf-8")
+		psfacade.WriteICalendar(w, feed)
+		return
+	}
+	c, ok := h.load(t)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	href := c.eventHref(t.resource)
+	ev, ok := c.byHref[href]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	etag := c.etags[href]
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", eventContentType)
+	w.Write(c.eventCalendar(ev))
+}
@@ -0,0 +1,260 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"github.com/fredcy/psfacade"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBackend serves a fixed set of events for teacher "fogel".
+type fakeBackend struct {
+	events []psfacade.Event
+}
+
+func (b *fakeBackend) Calendar(kind, name string) (psfacade.Feed, bool) {
+	if kind != "u" && kind != "r" {
+		return psfacade.Feed{}, false
+	}
+	ch := make(chan psfacade.Event, len(b.events))
+	if kind == "u" && name == "fogel" {
+		for _, ev := range b.events {
+			ch <- ev
+		}
+	}
+	close(ch)
+	return psfacade.Feed{ProdID: "-//test//EN", Name: name, Description: "test calendar",
+		Stamp: time.Now(), Events: ch}, true
+}
+
+func (b *fakeBackend) Home(principal *psfacade.Principal) []CalendarID {
+	if principal == nil || principal.Name != "fogel" {
+		return nil
+	}
+	return []CalendarID{{Kind: "u", Name: "fogel"}}
+}
+
+func testEvent(uid string, day int) psfacade.Event {
+	start := time.Date(2016, 9, day, 8, 0, 0, 0, time.UTC)
+	return psfacade.Event{UID: uid, Start: start, End: start.Add(55 * time.Minute), Summary: "Chemistry " + uid,
+		Description: "Chemistry\n\n#pscal_generated " + time.Now().Format("2006-01-02T15:04")}
+}
+
+// multistatus is the part of a multistatus response the tests look at.
+type multistatus struct {
+	SyncToken string `xml:"sync-token"`
+	Responses []struct {
+		Href     string `xml:"href"`
+		Status   string `xml:"status"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ETag            string `xml:"getetag"`
+				DisplayName     string `xml:"displayname"`
+				CalendarData    string `xml:"calendar-data"`
+				Principal       string `xml:"current-user-principal>href"`
+				CalendarHomeSet string `xml:"calendar-home-set>href"`
+				ResourceType    struct {
+					Calendar *struct{} `xml:"calendar"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// do sends a WebDAV request to the server as a CalDAV client would.
+func do(t *testing.T, srv *httptest.Server, method, path, depth, body string) (*http.Response, multistatus) {
+	t.Helper()
+	return doAs(t, srv, "", "", method, path, depth, body)
+}
+
+// doAs sends a WebDAV request as do does, authenticated as the user with
+// the password unless user is empty.
+func doAs(t *testing.T, srv *httptest.Server, user, password, method, path, depth, body string) (*http.Response, multistatus) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var ms multistatus
+	if resp.StatusCode == http.StatusMultiStatus {
+		if err := xml.Unmarshal(data, &ms); err != nil {
+			t.Fatalf("%s %s: %v\n%s", method, path, err, data)
+		}
+	}
+	return resp, ms
+}
+
+func TestPropfind(t *testing.T) {
+	backend := &fakeBackend{events: []psfacade.Event{testEvent("a@imsa.edu", 6), testEvent("b@imsa.edu", 7)}}
+	srv := httptest.NewServer(NewHandler("/caldav/", backend))
+	defer srv.Close()
+
+	resp, _ := do(t, srv, "OPTIONS", "/caldav/u/fogel/", "", "")
+	if !strings.Contains(resp.Header.Get("DAV"), "calendar-access") {
+		t.Errorf("OPTIONS DAV header = %q", resp.Header.Get("DAV"))
+	}
+
+	resp, ms := do(t, srv, "PROPFIND", "/caldav/u/fogel/", "1", `<?xml version="1.0"?>
+<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+  <d:prop><d:resourcetype/><d:displayname/><d:getetag/><cs:getctag/><d:quota-used-bytes/></d:prop>
+</d:propfind>`)
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND status %d", resp.StatusCode)
+	}
+	if len(ms.Responses) != 3 {
+		t.Fatalf("got %d responses, want the collection and 2 events", len(ms.Responses))
+	}
+	coll := ms.Responses[0]
+	if coll.Href != "/caldav/u/fogel/" || coll.Propstat[0].Prop.ResourceType.Calendar == nil ||
+		coll.Propstat[0].Prop.DisplayName != "fogel" {
+		t.Errorf("collection response %+v", coll)
+	}
+	if len(coll.Propstat) != 2 || !strings.Contains(coll.Propstat[1].Status, "404") {
+		t.Errorf("unknown property not reported missing: %+v", coll.Propstat)
+	}
+	ev := ms.Responses[1]
+	if ev.Href != "/caldav/u/fogel/a@imsa.edu.ics" || ev.Propstat[0].Prop.ETag == "" {
+		t.Errorf("event response %+v", ev)
+	}
+
+	resp, _ = do(t, srv, "GET", ev.Href, "", "")
+	if resp.Header.Get("ETag") != ev.Propstat[0].Prop.ETag {
+		t.Errorf("GET ETag %q, PROPFIND getetag %q", resp.Header.Get("ETag"), ev.Propstat[0].Prop.ETag)
+	}
+	if resp, _ = do(t, srv, "PUT", ev.Href, "", "BEGIN:VCALENDAR"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT status %d, want 405", resp.StatusCode)
+	}
+	if resp, _ = do(t, srv, "PROPFIND", "/caldav/x/fogel/", "0", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PROPFIND of unknown kind status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestReports(t *testing.T) {
+	backend := &fakeBackend{events: []psfacade.Event{testEvent("a@imsa.edu", 6), testEvent("b@imsa.edu", 7)}}
+	srv := httptest.NewServer(NewHandler("/caldav/", backend))
+	defer srv.Close()
+
+	_, ms := do(t, srv, "REPORT", "/caldav/u/fogel/", "1", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+    <c:time-range start="20160907T000000Z" end="20160908T000000Z"/>
+  </c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`)
+	if len(ms.Responses) != 1 || ms.Responses[0].Href != "/caldav/u/fogel/b@imsa.edu.ics" {
+		t.Fatalf("calendar-query time-range gave %+v", ms.Responses)
+	}
+	data := ms.Responses[0].Propstat[0].Prop.CalendarData
+	if !strings.Contains(data, "UID:b@imsa.edu\r\n") {
+		t.Errorf("calendar-data lacks the event:\n%q", data)
+	}
+	if errs := psfacade.ValidateICalendar([]byte(data)); len(errs) > 0 {
+		t.Errorf("calendar-data is invalid: %v", errs)
+	}
+
+	_, ms = do(t, srv, "REPORT", "/caldav/u/fogel/", "1", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <d:href>/caldav/u/fogel/a%40imsa.edu.ics</d:href>
+  <d:href>/caldav/u/fogel/missing.ics</d:href>
+</c:calendar-multiget>`)
+	if len(ms.Responses) != 2 || ms.Responses[0].Propstat[0].Prop.ETag == "" || !strings.Contains(ms.Responses[1].Status, "404") {
+		t.Errorf("calendar-multiget gave %+v", ms.Responses)
+	}
+
+	syncReport := func(token string) (*http.Response, multistatus) {
+		return do(t, srv, "REPORT", "/caldav/u/fogel/", "", `<d:sync-collection xmlns:d="DAV:">
+  <d:sync-token>`+token+`</d:sync-token><d:sync-level>1</d:sync-level>
+  <d:prop><d:getetag/></d:prop>
+</d:sync-collection>`)
+	}
+	_, ms = syncReport("")
+	if len(ms.Responses) != 2 || ms.SyncToken == "" {
+		t.Fatalf("initial sync gave %+v", ms)
+	}
+	token := ms.SyncToken
+
+	// Regenerating the same events changes only their generation stamps.
+	_, ms = syncReport(token)
+	if len(ms.Responses) != 0 || ms.SyncToken != token {
+		t.Errorf("sync without changes gave %+v", ms)
+	}
+
+	changed := testEvent("b@imsa.edu", 7)
+	changed.Summary = "Physics"
+	backend.events = []psfacade.Event{changed, testEvent("c@imsa.edu", 8)}
+	_, ms = syncReport(token)
+	got := map[string]string{}
+	for _, r := range ms.Responses {
+		got[r.Href] = r.Status
+	}
+	if len(got) != 3 || !strings.Contains(got["/caldav/u/fogel/a@imsa.edu.ics"], "404") ||
+		got["/caldav/u/fogel/b@imsa.edu.ics"] != "" || got["/caldav/u/fogel/c@imsa.edu.ics"] != "" {
+		t.Errorf("sync after changes gave %v", got)
+	}
+	if ms.SyncToken == token {
+		t.Error("sync token did not change")
+	}
+
+	if resp, _ := syncReport("urn:psfacade:sync:unknown"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unknown sync token status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	backend := &fakeBackend{events: []psfacade.Event{testEvent("a@imsa.edu", 6)}}
+	auth := &psfacade.Auth{
+		Authenticators: []psfacade.Authenticator{psfacade.APIKeys{
+			"fogel":  {Key: "fogel-key", Roles: []string{"calendar"}},
+			"office": {Key: "office-key", Roles: []string{"calendar"}},
+		}},
+		Routes: []psfacade.RouteRule{{Prefix: "/caldav/", Roles: []string{psfacade.AnyRole}}},
+	}
+	srv := httptest.NewServer(auth.Handler(NewHandler("/caldav/", backend)))
+	defer srv.Close()
+
+	// A client given only the server finds its principal, then the
+	// principal's calendar home, then the calendars in the home.
+	_, ms := doAs(t, srv, "fogel", "fogel-key", "PROPFIND", "/caldav/", "0", `<d:propfind xmlns:d="DAV:">
+  <d:prop><d:current-user-principal/></d:prop>
+</d:propfind>`)
+	if len(ms.Responses) != 1 || ms.Responses[0].Propstat[0].Prop.Principal != "/caldav/" {
+		t.Fatalf("current-user-principal gave %+v", ms.Responses)
+	}
+	_, ms = doAs(t, srv, "fogel", "fogel-key", "PROPFIND", "/caldav/", "0", `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-home-set/></d:prop>
+</d:propfind>`)
+	home := ms.Responses[0].Propstat[0].Prop.CalendarHomeSet
+	if home != "/caldav/" {
+		t.Fatalf("calendar-home-set is %q", home)
+	}
+	homeBody := `<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:displayname/></d:prop></d:propfind>`
+	_, ms = doAs(t, srv, "fogel", "fogel-key", "PROPFIND", home, "1", homeBody)
+	if len(ms.Responses) != 2 {
+		t.Fatalf("home of fogel has %d responses, want the home and a calendar", len(ms.Responses))
+	}
+	if cal := ms.Responses[1]; cal.Href != "/caldav/u/fogel/" || cal.Propstat[0].Prop.ResourceType.Calendar == nil {
+		t.Errorf("calendar in the home: %+v", cal)
+	}
+
+	_, ms = doAs(t, srv, "office", "office-key", "PROPFIND", home, "1", homeBody)
+	if len(ms.Responses) != 1 {
+		t.Errorf("home of a client without calendars has %d responses", len(ms.Responses))
+	}
+}
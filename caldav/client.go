@@ -0,0 +1,176 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// syncHashProperty marks the events written by Sync with the ContentHash
+// of the event, so that Sync can tell its events from the calendar owner's
+// and knows which need updating.
+const syncHashProperty = "X-PSFACADE-HASH"
+
+// Client is a CalDAV client of one calendar collection. It is the Store
+// used by Sync to write events into a CalDAV server.
+type Client struct {
+	URL        string // of the collection, ending in "/"
+	Username   string // for HTTP Basic authentication, if not empty
+	Password   string
+	HTTPClient *http.Client // if nil, http.DefaultClient is used
+}
+
+// do sends a request for the href, which is relative to the collection URL.
+func (c *Client) do(method, href string, body []byte, header http.Header) (*http.Response, error) {
+	base, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, base.ResolveReference(ref).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// check returns an error unless the response has one of the statuses.
+func check(resp *http.Response, statuses ...int) error {
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL, resp.Status, bytes.TrimSpace(msg))
+}
+
+const managedQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+// Managed implements Store. It reads every event in the collection and
+// returns those bearing the sync mark.
+func (c *Client) Managed() (map[string]StoredEvent, error) {
+	resp, err := c.do("REPORT", "", []byte(managedQuery), http.Header{
+		"Content-Type": {"application/xml; charset=utf-8"},
+		"Depth":        {"1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := check(resp, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"DAV: href"`
+			Propstat []struct {
+				Prop struct {
+					ETag         string `xml:"DAV: getetag"`
+					CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+				} `xml:"DAV: prop"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("REPORT %s: %v", c.URL, err)
+	}
+	managed := map[string]StoredEvent{}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			uid, hash := eventMark(ps.Prop.CalendarData)
+			if uid != "" && hash != "" {
+				managed[uid] = StoredEvent{UID: uid, Hash: hash, Href: r.Href, ETag: ps.Prop.ETag}
+			}
+		}
+	}
+	return managed, nil
+}
+
+// eventMark returns the UID and sync hash of the VEVENT in the iCalendar data.
+func eventMark(data string) (uid, hash string) {
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	inEvent := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		name, value, _ := strings.Cut(line, ":")
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent = true
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			inEvent = false
+		case inEvent && name == "UID":
+			uid = unescapeText(value)
+		case inEvent && name == syncHashProperty:
+			hash = unescapeText(value)
+		}
+	}
+	return uid, hash
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// Put implements Store.
+func (c *Client) Put(feed psfacade.Feed, ev psfacade.Event, old *StoredEvent) error {
+	var body bytes.Buffer
+	if err := psfacade.WriteICalendarEvent(&body, feed, ev, map[string]string{syncHashProperty: ev.ContentHash()}); err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {psfacade.ICalendarContentType + "; charset=utf-8"}}
+	href := url.PathEscape(ev.UID) + ".ics"
+	if old != nil {
+		href = old.Href
+		if old.ETag != "" {
+			header.Set("If-Match", old.ETag)
+		}
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := c.do("PUT", href, body.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return check(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+}
+
+// Delete implements Store. An event that is already gone is not an error.
+func (c *Client) Delete(old StoredEvent) error {
+	header := http.Header{}
+	if old.ETag != "" {
+		header.Set("If-Match", old.ETag)
+	}
+	resp, err := c.do("DELETE", old.Href, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return check(resp, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
@@ -0,0 +1,237 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"github.com/fredcy/psfacade"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	readPrivilege    = "<d:privilege><d:read/></d:privilege>"
+	supportedReports = "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+		"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+		"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>"
+)
+
+func constant(s string) func() string {
+	return func() string { return s }
+}
+
+// rootResource returns the principal and calendar home that is the handler's prefix.
+func (h *Handler) rootResource() resource {
+	home := hrefElement(h.Prefix)
+	return resource{href: h.Prefix, props: map[xml.Name]func() string{
+		{Space: nsDAV, Local: "resourcetype"}:               constant("<d:collection/><d:principal/>"),
+		{Space: nsDAV, Local: "displayname"}:                constant("PowerSchool calendars"),
+		{Space: nsDAV, Local: "current-user-principal"}:     constant(home),
+		{Space: nsDAV, Local: "principal-URL"}:              constant(home),
+		{Space: nsCalDAV, Local: "calendar-home-set"}:       constant(home),
+		{Space: nsDAV, Local: "current-user-privilege-set"}: constant(readPrivilege),
+	}}
+}
+
+// resource returns the calendar collection resource.
+func (c *collection) resource(h *Handler) resource {
+	return resource{href: c.href, props: map[xml.Name]func() string{
+		{Space: nsDAV, Local: "resourcetype"}:                        constant("<d:collection/><c:calendar/>"),
+		{Space: nsDAV, Local: "displayname"}:                         constant(escape(c.feed.Name)),
+		{Space: nsCalDAV, Local: "calendar-description"}:             constant(escape(c.feed.Description)),
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: constant(`<c:comp name="VEVENT"/>`),
+		{Space: nsDAV, Local: "supported-report-set"}:                constant(supportedReports),
+		{Space: nsDAV, Local: "sync-token"}:                          constant(escape(c.token)),
+		{Space: nsCS, Local: "getctag"}:                              constant(escape(c.token)),
+		{Space: nsDAV, Local: "current-user-privilege-set"}:          constant(readPrivilege),
+		{Space: nsDAV, Local: "current-user-principal"}:              constant(hrefElement(h.Prefix)),
+	}}
+}
+
+// eventHref returns the href of the event resource of the given name.
+func (c *collection) eventHref(resource string) string {
+	return c.href + url.PathEscape(strings.TrimSuffix(resource, ".ics")) + ".ics"
+}
+
+// eventResource returns the event resource at href, reported as the given href.
+func (c *collection) eventResource(href, asHref string) resource {
+	return resource{href: asHref, props: map[xml.Name]func() string{
+		{Space: nsDAV, Local: "getetag"}:        constant(escape(c.etags[href])),
+		{Space: nsDAV, Local: "getcontenttype"}: constant(eventContentType),
+		{Space: nsDAV, Local: "resourcetype"}:   constant(""),
+		{Space: nsCalDAV, Local: "calendar-data"}: func() string {
+			return escape(string(c.eventCalendar(c.byHref[href])))
+		},
+	}, extra: map[xml.Name]bool{{Space: nsCalDAV, Local: "calendar-data"}: true}}
+}
+
+// propfind reports the properties of the root and the collections in the
+// client's calendar home, a collection and its events (with Depth 1, the
+// default) or an event.
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, t target) {
+	var body propfindBody
+	ok, err := readBody(r, &body)
+	if err != nil {
+		http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	req := propRequest{names: body.Prop.names(), all: !ok || body.AllProp != nil, namesOnly: body.PropName != nil}
+	if t.kind == "" {
+		responses := []response{h.rootResource().response(req)}
+		if r.Header.Get("Depth") != "0" {
+			for _, id := range h.Backend.Home(psfacade.PrincipalFrom(r.Context())) {
+				if c, ok := h.load(target{kind: id.Kind, name: id.Name}); ok {
+					responses = append(responses, c.resource(h).response(req))
+				}
+			}
+		}
+		writeMultistatus(w, responses, "")
+		return
+	}
+	c, ok := h.load(t)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if t.resource != "" {
+		href := c.eventHref(t.resource)
+		if _, ok := c.byHref[href]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeMultistatus(w, []response{c.eventResource(href, href).response(req)}, "")
+		return
+	}
+	responses := []response{c.resource(h).response(req)}
+	if r.Header.Get("Depth") != "0" {
+		for _, href := range c.hrefs {
+			responses = append(responses, c.eventResource(href, href).response(req))
+		}
+	}
+	writeMultistatus(w, responses, "")
+}
+
+// report runs the calendar-query, calendar-multiget and sync-collection
+// reports on a collection.
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, t target) {
+	var body reportBody
+	if ok, err := readBody(r, &body); !ok || err != nil {
+		http.Error(w, "invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	if t.kind == "" || t.resource != "" {
+		writeError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+		return
+	}
+	c, ok := h.load(t)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var responses []response
+	switch body.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		for i, ev := range c.events {
+			if body.Filter == nil || matches(body.Filter.Comp, ev) {
+				responses = append(responses, c.eventResource(c.hrefs[i], c.hrefs[i]).response(body.props()))
+			}
+		}
+		writeMultistatus(w, responses, "")
+
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range body.Hrefs {
+			if own, ok := h.eventHrefIn(c, href); ok {
+				responses = append(responses, c.eventResource(own, href).response(body.props()))
+			} else {
+				responses = append(responses, response{href: href, status: http.StatusNotFound})
+			}
+		}
+		writeMultistatus(w, responses, "")
+
+	case xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		old := map[string]string{}
+		if body.SyncToken != "" {
+			if old, ok = h.since(c.href, body.SyncToken); !ok {
+				writeError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "valid-sync-token"})
+				return
+			}
+		}
+		for _, href := range c.hrefs {
+			if old[href] != c.etags[href] {
+				responses = append(responses, c.eventResource(href, href).response(body.props()))
+			}
+		}
+		var removed []string
+		for href := range old {
+			if _, ok := c.etags[href]; !ok {
+				removed = append(removed, href)
+			}
+		}
+		sort.Strings(removed)
+		for _, href := range removed {
+			responses = append(responses, response{href: href, status: http.StatusNotFound})
+		}
+		writeMultistatus(w, responses, c.token)
+
+	default:
+		writeError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+	}
+}
+
+// eventHrefIn returns the collection's own href for the event that href,
+// possibly an absolute URL or differently escaped, refers to.
+func (h *Handler) eventHrefIn(c *collection, href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	t, ok := h.parsePath(u.Path)
+	if !ok || t.resource == "" || h.collectionHref(t.kind, t.name) != c.href {
+		return "", false
+	}
+	own := c.eventHref(t.resource)
+	_, ok = c.byHref[own]
+	return own, ok
+}
+
+// matches reports whether the event passes the VCALENDAR comp-filter of a
+// calendar-query, which may hold a VEVENT comp-filter with a time-range.
+func matches(filter compFilter, ev psfacade.Event) bool {
+	if filter.Name != "VCALENDAR" {
+		return false
+	}
+	for _, comp := range filter.Comps {
+		if comp.Name != "VEVENT" {
+			return false
+		}
+		if tr := comp.TimeRange; tr != nil && !overlaps(ev, tr.Start, tr.End) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether the event overlaps the time range, whose ends are
+// UTC date-times and either of which may be empty (RFC 4791, section 9.9).
+func overlaps(ev psfacade.Event, rangeStart, rangeEnd string) bool {
+	start, end := ev.Start, ev.End
+	if ev.AllDay {
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+		end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local)
+	}
+	if !end.After(start) {
+		end = start
+	}
+	if rs, err := time.Parse("20060102T150405Z", rangeStart); err == nil {
+		if !end.After(rs) && !(end.Equal(start) && start.Equal(rs)) {
+			return false
+		}
+	}
+	if re, err := time.Parse("20060102T150405Z", rangeEnd); err == nil {
+		if !start.Before(re) {
+			return false
+		}
+	}
+	return true
+}
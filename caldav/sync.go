@@ -0,0 +1,100 @@
+package caldav
+
+import (
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"sort"
+)
+
+// StoredEvent is an event that Sync wrote into a Store.
+type StoredEvent struct {
+	UID  string
+	Hash string // ContentHash of the event when it was written
+	Href string // where the store keeps the event
+	ETag string
+}
+
+// Store is a calendar that Sync writes events into. Client is the Store of
+// a CalDAV collection; a Microsoft Graph calendar could be another.
+type Store interface {
+	// Managed returns the events in the store written by Sync, by UID.
+	Managed() (map[string]StoredEvent, error)
+	// Put writes the event, replacing old if it is not nil, and marks it
+	// with its ContentHash.
+	Put(feed psfacade.Feed, ev psfacade.Event, old *StoredEvent) error
+	// Delete removes an event written by Sync.
+	Delete(old StoredEvent) error
+}
+
+// SyncResult lists the UIDs of the events that Sync created, updated,
+// deleted or left alone, or would have in a dry run.
+type SyncResult struct {
+	Created, Updated, Deleted, Unchanged []string
+}
+
+func (r SyncResult) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged",
+		len(r.Created), len(r.Updated), len(r.Deleted), len(r.Unchanged))
+}
+
+// Sync makes the events that it manages in the store match the feed's
+// events by UID: it creates the new ones, updates those whose content
+// changed and deletes those no longer in the feed. Events in the store that
+// Sync did not write are left alone. With dryRun, Sync reports the changes
+// without making them. It stops at the first failed change, returning the
+// changes made so far.
+func Sync(store Store, feed psfacade.Feed, dryRun bool) (SyncResult, error) {
+	var events []psfacade.Event
+	for ev := range feed.Events {
+		events = append(events, ev)
+	}
+	var result SyncResult
+	managed, err := store.Managed()
+	if err != nil {
+		return result, err
+	}
+
+	seen := map[string]bool{}
+	for _, ev := range events {
+		if seen[ev.UID] {
+			continue
+		}
+		seen[ev.UID] = true
+		old, exists := managed[ev.UID]
+		switch {
+		case !exists:
+			if !dryRun {
+				if err := store.Put(feed, ev, nil); err != nil {
+					return result, err
+				}
+			}
+			result.Created = append(result.Created, ev.UID)
+		case old.Hash != ev.ContentHash():
+			if !dryRun {
+				if err := store.Put(feed, ev, &old); err != nil {
+					return result, err
+				}
+			}
+			result.Updated = append(result.Updated, ev.UID)
+		default:
+			result.Unchanged = append(result.Unchanged, ev.UID)
+		}
+	}
+
+	var gone []string
+	for uid := range managed {
+		if !seen[uid] {
+			gone = append(gone, uid)
+		}
+	}
+	sort.Strings(gone)
+	for _, uid := range gone {
+		if !dryRun {
+			if err := store.Delete(managed[uid]); err != nil {
+				return result, err
+			}
+		}
+		result.Deleted = append(result.Deleted, uid)
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package caldav
+
+import (
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn is a minimal in-memory CalDAV collection in the manner of
+// Radicale: it stores what is PUT verbatim and honors conditional requests.
+type standIn struct {
+	mu      sync.Mutex
+	items   map[string]string // body by path
+	etags   map[string]string
+	version int
+	writes  int
+}
+
+func newStandIn() *standIn {
+	return &standIn{items: map[string]string{}, etags: map[string]string{}}
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.EscapedPath()
+	etag, exists := s.etags[path]
+	if match := r.Header.Get("If-Match"); match != "" && match != etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		body, _ := io.ReadAll(r.Body)
+		s.version++
+		s.writes++
+		s.items[path] = string(body)
+		s.etags[path] = fmt.Sprintf(`"%d"`, s.version)
+		w.Header().Set("ETag", s.etags[path])
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "DELETE":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.writes++
+		delete(s.items, path)
+		delete(s.etags, path)
+		w.WriteHeader(http.StatusNoContent)
+	case "REPORT":
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<multistatus xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+		for p, body := range s.items {
+			fmt.Fprintf(w, `<response><href>%s</href><propstat><prop><getetag>%s</getetag><C:calendar-data>%s</C:calendar-data></prop>`+
+				`<status>HTTP/1.1 200 OK</status></propstat></response>`, p, escape(s.etags[p]), escape(body))
+		}
+		fmt.Fprint(w, `</multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func syncFeed(events ...psfacade.Event) psfacade.Feed {
+	ch := make(chan psfacade.Event, len(events))
+	for _, ev := range events {
+		ch <- ev
+	}
+	close(ch)
+	return psfacade.Feed{ProdID: "-//test//EN", Name: "fogel", Stamp: time.Now(), Events: ch}
+}
+
+func TestSync(t *testing.T) {
+	standIn := newStandIn()
+	// an event of the calendar's owner, which Sync must leave alone
+	standIn.items["/cal/own.ics"] = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:own\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	standIn.etags["/cal/own.ics"] = `"own"`
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+	client := &Client{URL: srv.URL + "/cal/"}
+
+	a, b, c := testEvent("a@imsa.edu", 6), testEvent("b@imsa.edu", 7), testEvent("c@imsa.edu", 8)
+
+	result, err := Sync(client, syncFeed(a, b), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 2 || standIn.writes != 0 {
+		t.Errorf("dry run: %v with %d writes", result, standIn.writes)
+	}
+
+	result, err = Sync(client, syncFeed(a, b), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 2 || len(standIn.items) != 3 {
+		t.Errorf("first sync: %v, %d items stored", result, len(standIn.items))
+	}
+	for p, body := range standIn.items {
+		if p != "/cal/own.ics" {
+			if errs := psfacade.ValidateICalendar([]byte(body)); len(errs) > 0 {
+				t.Errorf("%s is invalid: %v", p, errs)
+			}
+			if strings.Contains(body, "\r\nMETHOD:") {
+				t.Errorf("%s has a METHOD property:\n%s", p, body)
+			}
+		}
+	}
+
+	// regenerated events differ only in their generation stamps
+	a2, b2 := a, b
+	a2.Description = "Chemistry\n\n#pscal_generated 2000-01-01T00:00"
+	b2.Description = a2.Description
+	result, err = Sync(client, syncFeed(a2, b2), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unchanged) != 2 || standIn.writes != 2 {
+		t.Errorf("repeated sync: %v with %d writes", result, standIn.writes)
+	}
+
+	b.Summary = "Physics"
+	result, err = Sync(client, syncFeed(b, c), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(result.Created, result.Updated, result.Deleted) != "[c@imsa.edu] [b@imsa.edu] [a@imsa.edu]" {
+		t.Errorf("sync of changes: %+v", result)
+	}
+	if _, ok := standIn.items["/cal/own.ics"]; !ok {
+		t.Error("owner's event was deleted")
+	}
+	if body := standIn.items["/cal/b@imsa.edu.ics"]; !strings.Contains(body, "SUMMARY:Physics") {
+		t.Errorf("b was not updated:\n%s", body)
+	}
+}
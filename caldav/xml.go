@@ -0,0 +1,207 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// nsPrefixes are the prefixes declared on every multistatus response.
+var nsPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+const eventContentType = "text/calendar; charset=utf-8; component=VEVENT"
+
+// propNames is the list of property names in a DAV:prop request element.
+type propNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (p *propNames) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, len(p.Names))
+	for i, n := range p.Names {
+		names[i] = n.XMLName
+	}
+	return names
+}
+
+// propRequest is which properties a PROPFIND or REPORT asks for.
+type propRequest struct {
+	names     []xml.Name
+	all       bool // DAV:allprop, or no body
+	namesOnly bool // DAV:propname
+}
+
+type propfindBody struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// reportBody holds the elements of the supported REPORT bodies; XMLName
+// says which report it is.
+type reportBody struct {
+	XMLName   xml.Name
+	AllProp   *struct{}  `xml:"DAV: allprop"`
+	Prop      *propNames `xml:"DAV: prop"`
+	Hrefs     []string   `xml:"DAV: href"`
+	SyncToken string     `xml:"DAV: sync-token"`
+	Filter    *struct {
+		Comp compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+func (b reportBody) props() propRequest {
+	return propRequest{names: b.Prop.names(), all: b.AllProp != nil}
+}
+
+type compFilter struct {
+	Name      string       `xml:"name,attr"`
+	Comps     []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	TimeRange *struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+}
+
+// readBody decodes the XML request body into v, reporting false for an
+// empty body.
+func readBody(r *http.Request, v interface{}) (bool, error) {
+	err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// resource is something whose properties can be reported. Each property
+// function returns the inner XML of the property element.
+type resource struct {
+	href  string
+	props map[xml.Name]func() string
+	extra map[xml.Name]bool // properties left out of allprop
+}
+
+// response is a DAV:response element of a multistatus.
+type response struct {
+	href    string
+	status  int // for a response without properties
+	found   []string
+	missing []xml.Name
+}
+
+// response returns the response reporting the requested properties of the resource.
+func (res resource) response(req propRequest) response {
+	resp := response{href: res.href}
+	names := req.names
+	if req.all || req.namesOnly {
+		names = nil
+		for name := range res.props {
+			if req.namesOnly || !res.extra[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if names[i].Space != names[j].Space {
+				return names[i].Space < names[j].Space
+			}
+			return names[i].Local < names[j].Local
+		})
+	}
+	for _, name := range names {
+		value, ok := res.props[name]
+		switch {
+		case !ok:
+			resp.missing = append(resp.missing, name)
+		case req.namesOnly:
+			resp.found = append(resp.found, element(name, ""))
+		default:
+			resp.found = append(resp.found, element(name, value()))
+		}
+	}
+	return resp
+}
+
+// element returns the XML of an element, using the multistatus prefix of
+// its namespace if there is one.
+func element(name xml.Name, inner string) string {
+	tag, decl := name.Local, ""
+	if prefix, ok := nsPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag = "x:" + name.Local
+		decl = ` xmlns:x="` + escape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + tag + decl + "/>"
+	}
+	return "<" + tag + decl + ">" + inner + "</" + tag + ">"
+}
+
+// escape returns s escaped for XML character data or attribute values.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func hrefElement(href string) string {
+	return "<d:href>" + escape(href) + "</d:href>"
+}
+
+// writeMultistatus writes a 207 Multi-Status response, with the sync token
+// if it is not empty.
+func writeMultistatus(w http.ResponseWriter, responses []response, syncToken string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n")
+	fmt.Fprintf(w, `<d:multistatus xmlns:d="%s" xmlns:c="%s" xmlns:cs="%s">`+"\n", nsDAV, nsCalDAV, nsCS)
+	for _, resp := range responses {
+		fmt.Fprint(w, "<d:response>", hrefElement(resp.href))
+		if resp.status != 0 {
+			fmt.Fprint(w, statusElement(resp.status))
+		}
+		if len(resp.found) > 0 {
+			fmt.Fprint(w, "<d:propstat><d:prop>", strings.Join(resp.found, ""), "</d:prop>",
+				statusElement(http.StatusOK), "</d:propstat>")
+		}
+		if len(resp.missing) > 0 {
+			fmt.Fprint(w, "<d:propstat><d:prop>")
+			for _, name := range resp.missing {
+				fmt.Fprint(w, element(name, ""))
+			}
+			fmt.Fprint(w, "</d:prop>", statusElement(http.StatusNotFound), "</d:propstat>")
+		}
+		fmt.Fprint(w, "</d:response>\n")
+	}
+	if syncToken != "" {
+		fmt.Fprint(w, "<d:sync-token>", escape(syncToken), "</d:sync-token>\n")
+	}
+	fmt.Fprint(w, "</d:multistatus>\n")
+}
+
+func statusElement(status int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+// writeError writes a DAV:error response with the precondition element.
+func writeError(w http.ResponseWriter, status int, precondition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<d:error xmlns:d="%s" xmlns:c="%s">%s</d:error>`+"\n", nsDAV, nsCalDAV, element(precondition, ""))
+}
@@ -6,17 +6,16 @@ import (
 	ical "github.com/fredcy/icalendar"
 	"log"
 	"os"
-	"strings"
 	"time"
 )
 
 // CalDay is a single PowerSchool calendar day
 type CalDay struct {
-	date      time.Time
-	insession int
-	note      string
-	bellSched string
-	cycleDay  string
+	Date         time.Time `json:"date"`
+	InSession    bool      `json:"insession"`
+	Note         string    `json:"note"`
+	BellSchedule string    `json:"bell_schedule"`
+	CycleDay     string    `json:"cycle_day"`
 }
 
 func emptyifnull(s sql.NullString) string {
@@ -26,24 +25,41 @@ func emptyifnull(s sql.NullString) string {
 	return ""
 }
 
-// GetCalendarDays returns a channel with all of the calendar items
+// GetCalendarDays returns a channel with all of the calendar items from the
+// start of the previous school year on, so that the calendar feed keeps
+// last year's days.
 func GetCalendarDays(db *sql.DB) <-chan CalDay {
+	last, ok := YearTerm(GetTerms(db, CurrentYearID(db)-1))
+	if !ok {
+		last = currentYearTerm(db)
+	}
+	return getCalendarDays(db, last.FirstDay, time.Time{})
+}
+
+// getCalendarDays returns the calendar items from the date from through the
+// date to, or on without end if to is zero.
+func getCalendarDays(db *sql.DB, from, to time.Time) <-chan CalDay {
 	query := `
-SELECT to_char(cd.date_value, 'IYYY-MM-DD') date_str, cd.insession, cd.note, bs.name, cyd.abbreviation
-FROM terms terms1
-join calendar_day cd on cd.date_value >= terms1.firstday and cd.schoolid = terms1.schoolid
+SELECT to_char(cd.date_value, 'YYYY-MM-DD') date_str, cd.insession, cd.note, bs.name, cyd.abbreviation
+FROM calendar_day cd
 left outer join bell_schedule bs on cd.bell_schedule_id = bs.id
 left outer join cycle_day cyd on cd.cycle_day_id = cyd.id
-where terms1.id = :termid1 and terms1.schoolid = 140177
+where cd.schoolid = 140177 and cd.date_value >= to_date(:from, 'YYYY-MM-DD')%s
+order by cd.date_value
 `
-	yearid := getYearid()
-	termid1 := (yearid - 1) * 100
+	args := []interface{}{from.Format("2006-01-02")}
+	condition := ""
+	if !to.IsZero() {
+		condition = " and cd.date_value <= to_date(:to, 'YYYY-MM-DD')"
+		args = append(args, to.Format("2006-01-02"))
+	}
+	query = fmt.Sprintf(query, condition)
 	debug := os.Getenv("CALENDAR_DEBUG") != ""
 	if debug {
-		log.Println("termid", termid1, "query", query)
+		log.Println("args", args, "query", query)
 	}
 
-	rows, err := db.Query(query, termid1)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Panicf("query failed: %v", err)
 	}
@@ -54,21 +70,23 @@ where terms1.id = :termid1 and terms1.schoolid = 140177
 		for rows.Next() {
 			cd := CalDay{}
 			var date string
+			var insession int
 			var note, bellSched, cycleDay sql.NullString
-			err = rows.Scan(&date, &cd.insession, &note, &bellSched, &cycleDay)
+			err = rows.Scan(&date, &insession, &note, &bellSched, &cycleDay)
 			if err != nil {
 				log.Panic("rows.Scan: ", err)
 			}
-			cd.date, err = time.Parse("2006-01-02", date)
+			cd.Date, err = time.Parse("2006-01-02", date)
 			if err != nil {
 				log.Panic("time.Parse ", err)
 			}
-			cd.note = emptyifnull(note)
-			cd.bellSched = emptyifnull(bellSched)
-			cd.cycleDay = emptyifnull(cycleDay)
+			cd.InSession = insession != 0
+			cd.Note = emptyifnull(note)
+			cd.BellSchedule = emptyifnull(bellSched)
+			cd.CycleDay = emptyifnull(cycleDay)
 			if debug {
 				log.Printf("date=%v insession=%v note='%v' bellSched='%v' cycleDay='%v'",
-					cd.date, cd.insession, cd.note, cd.bellSched, cd.cycleDay)
+					cd.Date, cd.InSession, cd.Note, cd.BellSchedule, cd.CycleDay)
 			}
 			days <- cd
 		}
@@ -81,64 +99,28 @@ where terms1.id = :termid1 and terms1.schoolid = 140177
 }
 
 // GetCalendar returns iCalendar data for PowerSchool common calendar (ABCDI days, bell schedules, notes)
+//
+// Deprecated: use WriteICalendar with CalendarFeed.
 func GetCalendar(db *sql.DB) *ical.Component {
-	days := GetCalendarDays(db)
-	cal := ical.Component{}
-	cal.SetName("VCALENDAR")
-	cal.Set("VERSION", ical.VString("2.0"))
-	cal.Set("PRODID", ical.VStringf("-//imsa.edu//powerschool calendar//EN"))
-	cal.Set("METHOD", ical.VString("PUBLISH"))
-	cal.Set("CALSCALE", ical.VString("GREGORIAN"))
-	cal.Set("x-wr-calname", ical.VStringf("IMSA PowerSchool"))
-	cal.Set("x-wr-caldesc", ical.VStringf("IMSA PowerSchool common calendar"))
-	cal.Set("x-wrt-timezone", ical.VString("America/Chicago"))
-	vtimezone := calTimezone()
-	cal.AddComponent(&vtimezone)
-
-	dtstamp := ical.VDateTime(time.Now())
-	for day := range days {
-		summary := formatSummary(&day)
-		if summary == "" {
-			continue
-		}
-		e := ical.Component{}
-		e.SetName("VEVENT")
-		e.Set("DTSTART", ical.VDate(day.date)).Add("VALUE", ical.VString("DATE"))
-		e.Set("DTEND", ical.VDate(day.date.AddDate(0, 0, 1))).Add("VALUE", ical.VString("DATE"))
-		// this pattern of start and end makes the event an all-day event that displays at top
-		e.Set("SUMMARY", ical.VString(summary))
-		e.Set("DESCRIPTION", ical.VString(formatDescription(&day)))
-		e.Set("DTSTAMP", dtstamp)
-		e.Set("UID", ical.VString(fmt.Sprintf("PS-Calendar-%s@imsa.edu", day.date.Format("20060102"))))
-		cal.AddComponent(&e)
-	}
-	return &cal
-}
-
-var cycleDayDisplay = map[string]bool{
-	"A": true,
-	"B": true,
-	"C": true,
-	"D": true,
-	"I": true,
+	return CalendarFeed(db).Component()
 }
 
 // Generate SUMMARY string for given calendar item
 func formatSummary(day *CalDay) string {
 	var summary string
-	if cycleDayDisplay[day.cycleDay] {
-		summary += day.cycleDay
-		if day.bellSched != "" && !strings.HasPrefix(day.bellSched, "Full Day") {
-			summary += fmt.Sprintf(" (%s)", day.bellSched)
+	if rules.showCycleDay(day.CycleDay) {
+		summary += day.CycleDay
+		if rules.showBellSched(day.BellSchedule) {
+			summary += fmt.Sprintf(" (%s)", day.BellSchedule)
 		}
 	} else {
-		//log.Printf("ignoring cycle day %v", day.cycleDay)
+		//log.Printf("ignoring cycle day %v", day.CycleDay)
 	}
-	if day.note != "" {
+	if day.Note != "" {
 		if summary != "" {
 			summary += ": "
 		}
-		summary += day.note
+		summary += day.Note
 	}
 	return summary
 }
@@ -146,14 +128,14 @@ func formatSummary(day *CalDay) string {
 // Generate DESCRIPTION string for given calendar item
 func formatDescription(day *CalDay) string {
 	var description string
-	if day.cycleDay != "" {
-		description += ("Cycle Day: " + day.cycleDay + "\n")
+	if day.CycleDay != "" {
+		description += ("Cycle Day: " + day.CycleDay + "\n")
 	}
-	if day.bellSched != "" {
-		description += ("Bell Schedule: " + day.bellSched + "\n")
+	if day.BellSchedule != "" {
+		description += ("Bell Schedule: " + day.BellSchedule + "\n")
 	}
-	if day.note != "" {
-		description += ("Note: " + day.note + "\n")
+	if day.Note != "" {
+		description += ("Note: " + day.Note + "\n")
 	}
 	return description
 }
@@ -0,0 +1,208 @@
+package psfacade
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Calendar serializations of a Feed
+const (
+	ICalendarContentType = "text/calendar"
+	JCalContentType      = "application/calendar+json"
+	EventsContentType    = "application/json"
+)
+
+// WriteICalendar writes the feed to w as iCalendar (RFC 5545) text. The
+// calendar header is written and flushed at once and each event is written
+// as it arrives, so the feed is never held in memory.
+func WriteICalendar(w io.Writer, feed Feed) error {
+	if feed.ProdID == "" {
+		for range feed.Events {
+			// drain so that the producing goroutine can finish
+		}
+		return fmt.Errorf("calendar %q has no PRODID", feed.Name)
+	}
+	iw := NewICalWriter(w)
+	writeCalendarHeader(iw, feed, "PUBLISH")
+	iw.Flush()
+
+	stamp := feed.Stamp.UTC().Format(icalDateTime + "Z")
+	for ev := range feed.Events {
+		if err := writeEvent(iw, ev, stamp, nil); err != nil {
+			for range feed.Events {
+				// drain so that the producing goroutine can finish
+			}
+			return err
+		}
+	}
+	iw.End("VCALENDAR")
+	return iw.Err()
+}
+
+// WriteICalendarEvent writes a calendar of the feed holding just the event,
+// as stored in a CalDAV collection, so without a METHOD. The extra
+// properties, such as X-properties marking where the event came from, are
+// added to its VEVENT as TEXT values. The feed's events are not read.
+func WriteICalendarEvent(w io.Writer, feed Feed, ev Event, extra map[string]string) error {
+	if feed.ProdID == "" {
+		return fmt.Errorf("calendar %q has no PRODID", feed.Name)
+	}
+	iw := NewICalWriter(w)
+	writeCalendarHeader(iw, feed, "")
+	if err := writeEvent(iw, ev, feed.Stamp.UTC().Format(icalDateTime+"Z"), extra); err != nil {
+		return err
+	}
+	iw.End("VCALENDAR")
+	return iw.Err()
+}
+
+// writeCalendarHeader begins the VCALENDAR and writes its properties and
+// time zone, with a METHOD property unless method is empty. Calendar
+// resources stored in CalDAV collections must not have one (RFC 4791 4.1).
+func writeCalendarHeader(iw *ICalWriter, feed Feed, method string) {
+	iw.Begin("VCALENDAR")
+	iw.Property("VERSION", "2.0")
+	iw.Text("PRODID", feed.ProdID)
+	if method != "" {
+		iw.Property("METHOD", method)
+	}
+	iw.Property("CALSCALE", "GREGORIAN")
+	iw.Text("X-WR-CALNAME", feed.Name)
+	iw.Text("X-WR-CALDESC", feed.Description)
+	iw.Text("X-WR-TIMEZONE", calTimezoneID)
+	writeTimezone(iw)
+}
+
+// jprop returns a jCal property: name, parameters, type and value.
+func jprop(name string, params map[string]string, typ string, value interface{}) []interface{} {
+	if params == nil {
+		params = map[string]string{}
+	}
+	return []interface{}{name, params, typ, value}
+}
+
+// jcomponent returns a jCal component: name, properties and subcomponents.
+func jcomponent(name string, props [][]interface{}, subs []interface{}) []interface{} {
+	if props == nil {
+		props = [][]interface{}{}
+	}
+	if subs == nil {
+		subs = []interface{}{}
+	}
+	return []interface{}{name, props, subs}
+}
+
+// jcalOffset formats a UTC offset in seconds as a jCal utc-offset value.
+func jcalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+func jcalTimezone() []interface{} {
+	var observances []interface{}
+	for _, obs := range calTimezoneObservances {
+		observances = append(observances, jcomponent(strings.ToLower(obs.name), [][]interface{}{
+			jprop("tzname", nil, "text", obs.tzname),
+			jprop("tzoffsetfrom", nil, "utc-offset", jcalOffset(obs.offsetFrom)),
+			jprop("tzoffsetto", nil, "utc-offset", jcalOffset(obs.offsetTo)),
+			jprop("dtstart", nil, "date-time", obs.dtstart.Format("2006-01-02T15:04:05")),
+			jprop("rrule", nil, "recur", map[string]interface{}{"freq": "YEARLY", "bymonth": obs.month, "byday": obs.byday}),
+		}, nil))
+	}
+	return jcomponent("vtimezone", [][]interface{}{jprop("tzid", nil, "text", calTimezoneID)}, observances)
+}
+
+// jcalEvent returns the jCal VEVENT for the event, with the same properties
+// as the iCalendar form.
+func jcalEvent(ev Event, stamp string) []interface{} {
+	var props [][]interface{}
+	typ, layout := "date-time", "2006-01-02T15:04:05"
+	if ev.AllDay {
+		typ, layout = "date", "2006-01-02"
+	}
+	props = append(props, jprop("dtstart", nil, typ, ev.Start.Format(layout)))
+	if ev.End.After(ev.Start) {
+		props = append(props, jprop("dtend", nil, typ, ev.End.Format(layout)))
+	}
+	props = append(props,
+		jprop("summary", nil, "text", ev.Summary),
+		jprop("description", nil, "text", ev.Description))
+	if ev.Organizer != "" {
+		props = append(props, jprop("organizer", nil, "cal-address", "mailto:"+ev.Organizer))
+	}
+	props = append(props,
+		jprop("dtstamp", nil, "date-time", stamp),
+		jprop("uid", nil, "text", ev.UID))
+	if ev.Attendee != "" {
+		props = append(props, jprop("attendee",
+			map[string]string{"partstat": "ACCEPTED", "role": "REQ-PARTICIPANT"},
+			"cal-address", "mailto:"+ev.Attendee))
+	}
+	return jcomponent("vevent", props, nil)
+}
+
+// WriteJCal writes the feed to w as jCal (RFC 7265), writing each event as it arrives.
+func WriteJCal(w io.Writer, feed Feed) error {
+	header, err := json.Marshal([][]interface{}{
+		jprop("version", nil, "text", "2.0"),
+		jprop("prodid", nil, "text", feed.ProdID),
+		jprop("method", nil, "text", "PUBLISH"),
+		jprop("calscale", nil, "text", "GREGORIAN"),
+		jprop("x-wr-calname", nil, "unknown", feed.Name),
+		jprop("x-wr-caldesc", nil, "unknown", feed.Description),
+		jprop("x-wr-timezone", nil, "unknown", calTimezoneID),
+	})
+	if err != nil {
+		return err
+	}
+	timezone, err := json.Marshal(jcalTimezone())
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "[\"vcalendar\",%s,[%s", header, timezone); err != nil {
+		return err
+	}
+
+	stamp := feed.Stamp.UTC().Format("2006-01-02T15:04:05Z")
+	for ev := range feed.Events {
+		event, err := json.Marshal(jcalEvent(ev, stamp))
+		if err == nil {
+			_, err = fmt.Fprintf(w, ",\n%s", event)
+		}
+		if err != nil {
+			for range feed.Events {
+				// drain so that the producing goroutine can finish
+			}
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]]\n")
+	return err
+}
+
+// WriteEventsJSON writes the feed's events to w as a flat JSON array of
+// Event values, writing each event as it arrives.
+func WriteEventsJSON(w io.Writer, feed Feed) error {
+	enc := json.NewEncoder(w)
+	sep := "["
+	for ev := range feed.Events {
+		io.WriteString(w, sep)
+		if err := enc.Encode(&ev); err != nil {
+			for range feed.Events {
+				// drain so that the producing goroutine can finish
+			}
+			return err
+		}
+		sep = ","
+	}
+	if sep == "[" {
+		io.WriteString(w, sep)
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
@@ -0,0 +1,84 @@
+package psfacade
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testFeed(events ...Event) Feed {
+	ch := make(chan Event, len(events))
+	for _, ev := range events {
+		ch <- ev
+	}
+	close(ch)
+	return Feed{ProdID: "-//test//EN", Name: "Test", Description: "test feed",
+		Stamp: time.Date(2016, 9, 1, 8, 0, 0, 0, time.UTC), Events: ch}
+}
+
+var testEvent = Event{
+	UID:       "PS-1-1@imsa.edu",
+	Start:     time.Date(2016, 9, 6, 8, 0, 0, 0, time.UTC),
+	End:       time.Date(2016, 9, 6, 8, 55, 0, 0, time.UTC),
+	Summary:   "Chemistry",
+	Organizer: "fogel@imsa.edu",
+	Attendee:  "fogel@imsa.edu",
+}
+
+func TestWriteJCal(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJCal(&buf, testFeed(testEvent)); err != nil {
+		t.Fatal(err)
+	}
+	var jcal []interface{}
+	if err := json.Unmarshal(buf.Bytes(), &jcal); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(jcal) != 3 || jcal[0] != "vcalendar" {
+		t.Fatalf("not a vcalendar: %s", buf.String())
+	}
+	subs := jcal[2].([]interface{})
+	if len(subs) != 2 {
+		t.Fatalf("got %d subcomponents, want timezone and one event", len(subs))
+	}
+	event := subs[1].([]interface{})
+	if event[0] != "vevent" {
+		t.Errorf("got %v, want vevent", event[0])
+	}
+	found := false
+	for _, prop := range event[1].([]interface{}) {
+		p := prop.([]interface{})
+		if p[0] == "dtstart" {
+			found = true
+			if p[2] != "date-time" || p[3] != "2016-09-06T08:00:00" {
+				t.Errorf("dtstart = %v", p)
+			}
+		}
+	}
+	if !found {
+		t.Error("no dtstart")
+	}
+}
+
+func TestWriteEventsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEventsJSON(&buf, testFeed()); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "[]\n" {
+		t.Errorf("empty feed gave %q", got)
+	}
+
+	buf.Reset()
+	if err := WriteEventsJSON(&buf, testFeed(testEvent, testEvent)); err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(events) != 2 || events[0].UID != testEvent.UID || !events[0].End.Equal(testEvent.End) {
+		t.Errorf("got %+v", events)
+	}
+}
@@ -0,0 +1,461 @@
+// Command psfacade exports PowerSchool calendars, schedules and rosters to
+// files, for cron jobs that publish static feeds.
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"github.com/fredcy/psfacade/caldav"
+	_ "github.com/mattn/go-oci8"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+var conffile = flag.String("conf", "ps.conf", "PowerSchool connection config file")
+var rulesfile = flag.String("rules", "", "JSON file of calendar rules (optional)")
+
+const usage = `usage: psfacade [-conf ps.conf] [-rules rules.json] command [flags] [args]
+
+commands:
+  teacher [-format ics|json|csv] [-o dir] loginid...
+  room [-format ics|json|csv] [-o dir] room...
+  calendar [-noschool] [-format ics|json|csv] [-o dir]
+  students [-format json|csv|xlsx] [-o dir] [-policy policy.json] [-role role] [-fields f1,f2] [-columns c1,c2]
+           [-room prefix] [-grade n] [-inactive]
+  conflicts [-rooms] [-format text|json|csv] [-o dir] loginid-or-room...
+  utilization [-format json|csv|matrix] [-o dir] term...
+  workload [-format json|csv] [-o dir] term...
+  export -o dir
+  sync [-n] -url collection-url [-user name] loginid...
+
+Output goes to standard output unless -o names a directory, in which case
+each result is written to a file named for it (e.g. fogel.ics).
+
+students shows only the fields that the privacy policy lets the role see,
+and logs the sensitive fields it reveals as the server does.
+
+sync writes each teacher's meetings into a CalDAV calendar, replacing
+{loginid} in the URL with the teacher's loginid. The password is taken
+from $PSFACADE_CALDAV_PASSWORD. With -n it only lists the changes.
+`
+
+// command is a subcommand and the flags common to all subcommands.
+type command struct {
+	flags  *flag.FlagSet
+	format *string
+	outdir *string
+}
+
+func newCommand(name, defaultFormat string) command {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return command{
+		flags:  fs,
+		format: fs.String("format", defaultFormat, "output format"),
+		outdir: fs.String("o", "", "output directory (default is standard output)"),
+	}
+}
+
+// output writes the result named name using write, either to standard
+// output or to a file in the output directory.
+func (c command) output(name string, write func(io.Writer) error) {
+	if *c.outdir == "" {
+		if err := write(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	ext := *c.format
+	switch ext {
+	case "text":
+		ext = "txt"
+	case "matrix":
+		ext = "json"
+	}
+	filename := filepath.Join(*c.outdir, safeFileName(name)+"."+ext)
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := write(f); err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s", filename)
+}
+
+// safeFileName returns name, such as a room, made safe as a file name in
+// the output directory: path separators become underscores and a name of
+// only dots gets a leading underscore.
+func safeFileName(name string) string {
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// writeJSON writes the items to w as a JSON array as they arrive.
+func writeJSON[T any](w io.Writer, items <-chan T) error {
+	enc := json.NewEncoder(w)
+	sep := "["
+	for item := range items {
+		fmt.Fprint(w, sep)
+		if err := enc.Encode(&item); err != nil {
+			for range items {
+				// drain so that the producing goroutine can finish
+			}
+			return err
+		}
+		sep = ","
+	}
+	if sep == "[" {
+		fmt.Fprint(w, sep)
+	}
+	_, err := fmt.Fprintln(w, "]")
+	return err
+}
+
+// parse parses the command arguments and exits unless the format is one of those given.
+func (c command) parse(args []string, formats ...string) {
+	c.flags.Parse(args)
+	for _, f := range formats {
+		if *c.format == f {
+			return
+		}
+	}
+	log.Fatalf("%s: unsupported format %q (use one of %v)", c.flags.Name(), *c.format, formats)
+}
+
+func openDB() *sql.DB {
+	db, err := sql.Open("oci8", psfacade.MakeDSN(psfacade.GetConfig(*conffile)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+// schedule runs the teacher and room commands.
+func schedule(db *sql.DB, name string, args []string) {
+	c := newCommand(name, "ics")
+	c.parse(args, "ics", "json", "csv")
+	if c.flags.NArg() == 0 {
+		log.Fatalf("%s: no %s given", name, name)
+	}
+	sched, feed := psfacade.GetTeacherSched, psfacade.TeacherFeed
+	if name == "room" {
+		sched, feed = psfacade.GetRoomSched, psfacade.RoomFeed
+	}
+	for _, id := range c.flags.Args() {
+		c.output(id, func(w io.Writer) error {
+			switch *c.format {
+			case "json":
+				return writeJSON(w, sched(db, id))
+			case "csv":
+				return psfacade.WriteMeetingsCSV(w, sched(db, id))
+			}
+			return psfacade.WriteICalendar(w, feed(db, id))
+		})
+	}
+}
+
+func calendar(db *sql.DB, args []string) {
+	c := newCommand("calendar", "ics")
+	noschool := c.flags.Bool("noschool", false, "only the days without school")
+	c.parse(args, "ics", "json", "csv")
+	name, days, feed := "cal", psfacade.GetCalendarDays, psfacade.CalendarFeed
+	if *noschool {
+		name = "noschool"
+		days = func(db *sql.DB) <-chan psfacade.CalDay {
+			return sliceChan(psfacade.GetSchoolCalendar(db).NoSchoolDays())
+		}
+		feed = psfacade.NoSchoolFeed
+	}
+	c.output(name, func(w io.Writer) error {
+		switch *c.format {
+		case "json":
+			return writeJSON(w, days(db))
+		case "csv":
+			return psfacade.WriteCalendarDaysCSV(w, days(db))
+		}
+		return psfacade.WriteICalendar(w, feed(db))
+	})
+}
+
+// sliceChan returns a closed channel holding the items.
+func sliceChan[T any](items []T) <-chan T {
+	ch := make(chan T, len(items))
+	for _, item := range items {
+		ch <- item
+	}
+	close(ch)
+	return ch
+}
+
+func students(db *sql.DB, args []string) {
+	c := newCommand("students", "json")
+	fields := c.flags.String("fields", "", "comma-separated optional fields: "+strings.Join(psfacade.StudentFieldNames(), ","))
+	room := c.flags.String("room", "", "only students in rooms starting with this prefix")
+	grade := c.flags.Int("grade", 0, "only students in this grade")
+	columns := c.flags.String("columns", "", "comma-separated columns, in order, for csv and xlsx (default is the basic fields then -fields)")
+	inactive := c.flags.Bool("inactive", false, "include students not currently enrolled")
+	policyfile := c.flags.String("policy", "", "student privacy policy file (default is the built-in policy)")
+	role := c.flags.String("role", "", "policy role whose fields to show (default is the policy's default role)")
+	c.parse(args, "json", "csv", "xlsx")
+
+	policy := psfacade.DefaultStudentPolicy()
+	if *policyfile != "" {
+		policy = psfacade.GetStudentPolicy(*policyfile)
+	}
+	if *role == "" {
+		*role = policy.DefaultRole
+	}
+	if _, ok := policy.Roles[*role]; !ok {
+		log.Fatalf("students: the policy has no role %q", *role)
+	}
+	if *room != "" && !policy.Visible(*role, "room") {
+		log.Fatalf("students: role %s may not filter by room", *role)
+	}
+	if *grade != 0 && !policy.Visible(*role, "grade_level") {
+		log.Fatalf("students: role %s may not filter by grade", *role)
+	}
+	if *inactive && !policy.Visible(*role, "enroll_status") {
+		log.Fatalf("students: role %s may not include inactive students", *role)
+	}
+
+	var requested []string
+	if *fields != "" {
+		requested = strings.Split(*fields, ",")
+	}
+	if err := psfacade.CheckStudentFields(requested, true); err != nil {
+		log.Fatal(err)
+	}
+	cols := psfacade.StudentColumns(requested)
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+		var err error
+		if requested, err = psfacade.CheckStudentColumns(cols); err != nil {
+			log.Fatal(err)
+		}
+	}
+	filter := psfacade.StudentFilter{
+		Room:            *room,
+		Grade:           *grade,
+		Fields:          policy.VisibleFields(*role, requested),
+		AllowSensitive:  true, // the policy has already screened the fields
+		IncludeInactive: *inactive,
+	}
+	c.output("students", func(w io.Writer) error {
+		enc := policy.NewEncoder(w, *role, commandClient(), requested)
+		defer enc.Close()
+		students := enc.Redact(psfacade.FindStudents(db, filter))
+		switch *c.format {
+		case "csv":
+			return psfacade.WriteStudentsCSV(w, students, cols)
+		case "xlsx":
+			return psfacade.WriteStudentsXLSX(w, students, cols)
+		}
+		return writeJSON(w, students)
+	})
+}
+
+// commandClient names the user running the command, for the log of
+// student data access.
+func commandClient() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("psfacade command (%s@%s)", name, host)
+}
+
+func conflicts(db *sql.DB, args []string) {
+	c := newCommand("conflicts", "text")
+	rooms := c.flags.Bool("rooms", false, "arguments are rooms rather than teacher loginids")
+	c.parse(args, "text", "json", "csv")
+	if c.flags.NArg() == 0 {
+		log.Fatal("conflicts: no teachers or rooms given")
+	}
+	for _, id := range c.flags.Args() {
+		var found []psfacade.Conflict
+		if *rooms {
+			found = psfacade.FindConflicts(psfacade.GetRoomSched(db, id))
+		} else {
+			found = psfacade.FindConflicts(psfacade.GetTeacherSched(db, id))
+		}
+		if found == nil {
+			found = []psfacade.Conflict{} // so that JSON output is [] rather than null
+		}
+		c.output(id+"-conflicts", func(w io.Writer) error {
+			switch *c.format {
+			case "json":
+				return json.NewEncoder(w).Encode(found)
+			case "csv":
+				cw := csv.NewWriter(w)
+				cw.Write([]string{"id", "first", "second"})
+				for _, conflict := range found {
+					cw.Write([]string{id, describe(conflict.First), describe(conflict.Second)})
+				}
+				cw.Flush()
+				return cw.Error()
+			}
+			for _, conflict := range found {
+				fmt.Fprintf(w, "%s: %s overlaps %s\n", id, describe(conflict.First), describe(conflict.Second))
+			}
+			return nil
+		})
+	}
+}
+
+// utilization reports the use of the rooms during each of the terms, given
+// by abbreviation.
+func utilization(db *sql.DB, args []string) {
+	c := newCommand("utilization", "json")
+	c.parse(args, "json", "csv", "matrix")
+	if c.flags.NArg() == 0 {
+		log.Fatal("utilization: no terms given")
+	}
+	for _, abbreviation := range c.flags.Args() {
+		report, ok := psfacade.GetRoomUtilization(db, abbreviation)
+		if !ok {
+			log.Fatalf("utilization: no term %q this year", abbreviation)
+		}
+		c.output(abbreviation+"-utilization", func(w io.Writer) error {
+			switch *c.format {
+			case "csv":
+				return psfacade.WriteUtilizationCSV(w, report)
+			case "matrix":
+				return json.NewEncoder(w).Encode(report.Matrix())
+			}
+			return json.NewEncoder(w).Encode(report)
+		})
+	}
+}
+
+// workload reports the teaching loads of the teachers during each of the
+// terms, given by abbreviation.
+func workload(db *sql.DB, args []string) {
+	c := newCommand("workload", "json")
+	c.parse(args, "json", "csv")
+	if c.flags.NArg() == 0 {
+		log.Fatal("workload: no terms given")
+	}
+	for _, abbreviation := range c.flags.Args() {
+		workloads, ok := psfacade.GetTeacherWorkload(db, abbreviation)
+		if !ok {
+			log.Fatalf("workload: no term %q this year", abbreviation)
+		}
+		c.output(abbreviation+"-workload", func(w io.Writer) error {
+			if *c.format == "csv" {
+				return psfacade.WriteWorkloadCSV(w, workloads)
+			}
+			return writeJSON(w, sliceChan(workloads))
+		})
+	}
+}
+
+// export writes every calendar to the output directory as a static site.
+func export(db *sql.DB, args []string) {
+	c := newCommand("export", "ics")
+	c.parse(args, "ics")
+	if *c.outdir == "" {
+		log.Fatal("export: -o dir is required")
+	}
+	index, err := psfacade.ExportCalendars(db, *c.outdir)
+	if err != nil {
+		log.Fatalf("export: %v", err)
+	}
+	log.Printf("exported %d calendars to %s", len(index.Calendars), *c.outdir)
+}
+
+// syncCalendars writes the meetings of each teacher into a CalDAV collection.
+func syncCalendars(db *sql.DB, args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	target := fs.String("url", "", "CalDAV collection URL, in which {loginid} is replaced")
+	user := fs.String("user", "", "user name for the CalDAV server")
+	dryRun := fs.Bool("n", false, "list the changes without making them")
+	fs.Parse(args)
+	if *target == "" || fs.NArg() == 0 {
+		log.Fatal("sync: -url and at least one loginid are required")
+	}
+	for _, loginid := range fs.Args() {
+		client := &caldav.Client{
+			URL:      strings.ReplaceAll(*target, "{loginid}", url.PathEscape(loginid)),
+			Username: *user,
+			Password: os.Getenv("PSFACADE_CALDAV_PASSWORD"),
+		}
+		result, err := caldav.Sync(client, psfacade.TeacherFeed(db, loginid), *dryRun)
+		if err != nil {
+			log.Fatalf("sync %s: %v (after %v)", loginid, err, result)
+		}
+		if *dryRun {
+			for _, change := range []struct {
+				action string
+				uids   []string
+			}{{"create", result.Created}, {"update", result.Updated}, {"delete", result.Deleted}} {
+				for _, uid := range change.uids {
+					fmt.Printf("%s: would %s %s\n", loginid, change.action, uid)
+				}
+			}
+		}
+		log.Printf("sync %s to %s: %v", loginid, client.URL, result)
+	}
+}
+
+// describe returns a one-line description of the meeting.
+func describe(m psfacade.Meeting) string {
+	return fmt.Sprintf("%s-%s %s-%s (%s, %s)", m.CourseNumber, m.SectionNumber,
+		m.Start.Format("2006-01-02 15:04"), m.End().Format("15:04"), m.LoginID, m.Room)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *rulesfile != "" {
+		psfacade.SetRules(psfacade.GetRules(*rulesfile))
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "teacher", "room", "calendar", "students", "conflicts", "utilization", "workload", "export", "sync":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db := openDB()
+	defer db.Close()
+	switch cmd {
+	case "teacher", "room":
+		schedule(db, cmd, args)
+	case "calendar":
+		calendar(db, args)
+	case "students":
+		students(db, args)
+	case "conflicts":
+		conflicts(db, args)
+	case "utilization":
+		utilization(db, args)
+	case "workload":
+		workload(db, args)
+	case "export":
+		export(db, args)
+	case "sync":
+		syncCalendars(db, args)
+	}
+}
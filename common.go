@@ -5,46 +5,42 @@ import (
 	"time"
 )
 
-func getYearid() int {
-	now := time.Now()
-	var academicyear int
-	if now.Month() < 7 {
-		academicyear = now.Year()
-	} else {
-		academicyear = now.Year() + 1
-	}
-	yearid := academicyear - 1991 // the usual PowerSchool conversion
-	return yearid
+const calTimezoneID = "America/Chicago"
+
+// tzObservance is one of the DAYLIGHT and STANDARD rules of the time zone.
+type tzObservance struct {
+	name       string // DAYLIGHT or STANDARD
+	tzname     string
+	offsetFrom int // seconds east of UTC
+	offsetTo   int
+	dtstart    time.Time
+	month      int    // RRULE BYMONTH
+	byday      string // RRULE BYDAY
+}
+
+var calTimezoneObservances = []tzObservance{
+	{"DAYLIGHT", "CDT", -6 * 3600, -5 * 3600, time.Date(1970, 3, 8, 2, 0, 0, 0, time.UTC), 3, "2SU"},
+	{"STANDARD", "CST", -5 * 3600, -6 * 3600, time.Date(1970, 11, 1, 2, 0, 0, 0, time.UTC), 11, "1SU"},
 }
 
 // cal_timezone returns a standard VTIMEZONE element for the America/Chicago zone
 func calTimezone() ical.Component {
 	timezone := ical.Component{}
 	timezone.SetName("VTIMEZONE")
-	timezone.Set("TZID", ical.VString("America/Chicago"))
-	daylight := ical.Component{}
-	daylight.SetName("DAYLIGHT")
-	daylight.Add("tzname", ical.VString("CDT"))
-	daylight.Add("tzoffsetfrom", ical.VUtcOffset(-6*3600))
-	daylight.Add("tzoffsetto", ical.VUtcOffset(-5*3600))
-	daylight.Add("dtstart", ical.VDateTime(time.Date(1970, 3, 8, 2, 0, 0, 0, time.UTC)))
-	rrv := ical.VEnumList{}
-	rrv.AddValue("FREQ", ical.VString("YEARLY"))
-	rrv.AddValue("BYMONTH", ical.VInt(3))
-	rrv.AddValue("BYDAY", ical.VString("2SU"))
-	daylight.Add("RRULE", rrv)
-	timezone.AddComponent(&daylight)
-	standard := ical.Component{}
-	standard.SetName("STANDARD")
-	standard.Add("tzname", ical.VString("CST"))
-	standard.Add("tzoffsetfrom", ical.VUtcOffset(-5*3600))
-	standard.Add("tzoffsetto", ical.VUtcOffset(-6*3600))
-	standard.Add("dtstart", ical.VDateTime(time.Date(1970, 11, 1, 2, 0, 0, 0, time.UTC)))
-	rrv = ical.VEnumList{}
-	rrv.AddValue("FREQ", ical.VString("YEARLY"))
-	rrv.AddValue("BYMONTH", ical.VInt(11))
-	rrv.AddValue("BYDAY", ical.VString("1SU"))
-	standard.Add("RRULE", rrv)
-	timezone.AddComponent(&standard)
+	timezone.Set("TZID", ical.VString(calTimezoneID))
+	for _, obs := range calTimezoneObservances {
+		c := ical.Component{}
+		c.SetName(obs.name)
+		c.Add("tzname", ical.VString(obs.tzname))
+		c.Add("tzoffsetfrom", ical.VUtcOffset(obs.offsetFrom))
+		c.Add("tzoffsetto", ical.VUtcOffset(obs.offsetTo))
+		c.Add("dtstart", ical.VDateTime(obs.dtstart))
+		rrv := ical.VEnumList{}
+		rrv.AddValue("FREQ", ical.VString("YEARLY"))
+		rrv.AddValue("BYMONTH", ical.VInt(obs.month))
+		rrv.AddValue("BYDAY", ical.VString(obs.byday))
+		c.Add("RRULE", rrv)
+		timezone.AddComponent(&c)
+	}
 	return timezone
 }
@@ -0,0 +1,39 @@
+package psfacade
+
+import (
+	"sort"
+	"time"
+)
+
+// Conflict is a pair of meetings that overlap in time.
+type Conflict struct {
+	First  Meeting `json:"first"`
+	Second Meeting `json:"second"`
+}
+
+// End returns the time the meeting ends.
+func (m Meeting) End() time.Time {
+	return m.Start.Add(time.Duration(m.Duration) * time.Minute)
+}
+
+// FindConflicts returns the pairs of meetings that overlap, such as two
+// sections scheduled in one room at the same time. The meetings would
+// normally all be from one teacher's or one room's schedule.
+func FindConflicts(meetings <-chan Meeting) []Conflict {
+	var sorted []Meeting
+	for m := range meetings {
+		sorted = append(sorted, m)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	var conflicts []Conflict
+	for i, m := range sorted {
+		for _, later := range sorted[i+1:] {
+			if !later.Start.Before(m.End()) {
+				break
+			}
+			conflicts = append(conflicts, Conflict{m, later})
+		}
+	}
+	return conflicts
+}
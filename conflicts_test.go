@@ -0,0 +1,29 @@
+package psfacade
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindConflicts(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 9, 3, hour, minute, 0, 0, time.UTC)
+	}
+	meetings := make(chan Meeting, 4)
+	meetings <- Meeting{CourseNumber: "PHY201", Start: at(9, 0), Duration: 50}
+	meetings <- Meeting{CourseNumber: "MAT321", Start: at(8, 0), Duration: 75}
+	meetings <- Meeting{CourseNumber: "CHE101", Start: at(9, 15), Duration: 30}
+	meetings <- Meeting{CourseNumber: "BIO101", Start: at(9, 50), Duration: 30}
+	close(meetings)
+
+	conflicts := FindConflicts(meetings)
+	if len(conflicts) != 2 {
+		t.Fatalf("expected 2 conflicts, got %v", conflicts)
+	}
+	if conflicts[0].First.CourseNumber != "MAT321" || conflicts[0].Second.CourseNumber != "PHY201" {
+		t.Errorf("first conflict is %v", conflicts[0])
+	}
+	if conflicts[1].First.CourseNumber != "PHY201" || conflicts[1].Second.CourseNumber != "CHE101" {
+		t.Errorf("second conflict is %v", conflicts[1])
+	}
+}
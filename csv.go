@@ -0,0 +1,88 @@
+package psfacade
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var meetingCSVHeader = []string{"loginid", "start", "end", "duration", "course_number", "section_number",
+	"course_name", "room", "term", "cycle_day", "period_start", "period_end", "bell_schedule"}
+
+// WriteMeetingsCSV writes the meetings to w as CSV with a header row.
+func WriteMeetingsCSV(w io.Writer, meetings <-chan Meeting) error {
+	cw := csv.NewWriter(w)
+	cw.Write(meetingCSVHeader)
+	for m := range meetings {
+		cw.Write([]string{
+			m.LoginID,
+			m.Start.Format("2006-01-02 15:04"),
+			m.End().Format("2006-01-02 15:04"),
+			strconv.Itoa(m.Duration),
+			m.CourseNumber,
+			m.SectionNumber,
+			m.CourseName,
+			m.Room,
+			m.Term,
+			m.CycleDay,
+			strconv.Itoa(m.PeriodStart),
+			strconv.Itoa(m.PeriodEnd),
+			m.BellSchedule,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCalendarDaysCSV writes the calendar days to w as CSV with a header row.
+func WriteCalendarDaysCSV(w io.Writer, days <-chan CalDay) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "insession", "cycle_day", "bell_schedule", "note"})
+	for d := range days {
+		cw.Write([]string{
+			d.Date.Format("2006-01-02"),
+			strconv.FormatBool(d.InSession),
+			d.CycleDay,
+			d.BellSchedule,
+			d.Note,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// studentRecord returns the named columns of the student.
+func studentRecord(s *Student, columns []string) []string {
+	var record []string
+	for _, name := range columns {
+		if value := studentFieldValue(s, name); value != nil {
+			record = append(record, *value)
+		} else {
+			record = append(record, "")
+		}
+	}
+	return record
+}
+
+// WriteStudentsCSV writes the students to w as CSV with a header row of the
+// column names (see StudentColumns), writing each student as it arrives.
+func WriteStudentsCSV(w io.Writer, students <-chan Student, columns []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(columns)
+	for s := range students {
+		cw.Write(studentRecord(&s, columns))
+		cw.Flush()
+	}
+	return cw.Error()
+}
+
+// WriteStudentsXLSX writes the students to w as an XLSX workbook with a
+// header row of the column names, writing each student as it arrives.
+func WriteStudentsXLSX(w io.Writer, students <-chan Student, columns []string) error {
+	x := NewXLSXWriter(w, "Students")
+	x.WriteRow(columns)
+	for s := range students {
+		x.WriteRow(studentRecord(&s, columns))
+	}
+	return x.Close()
+}
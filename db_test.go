@@ -54,8 +54,8 @@ func TestTeacherSched(t *testing.T) {
 	ch := GetTeacherSched(db, "fogel")
 	var c int
 	for mtg := range ch {
-		if mtg.loginid != "fogel" {
-			t.Errorf("mtg.loginid = %v, expected fogel", mtg.loginid)
+		if mtg.LoginID != "fogel" {
+			t.Errorf("mtg.LoginID = %v, expected fogel", mtg.LoginID)
 		}
 		c++
 	}
@@ -70,12 +70,14 @@ func TestCalendar(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	calstr := GetCalendar(db).String()
-	callen := len(calstr)
+	cal := writeFeed(t, CalendarFeed(db))
+	callen := len(cal)
 	if testing.Verbose() {
-		fmt.Print(calstr, callen)
+		fmt.Print(string(cal), callen)
 	}
 	if callen < 20000 || callen > 500000 {
 		t.Errorf("generated calendar length (%v) is not valid", callen)
 	}
+	checkICalendar(t, cal)
+	checkICalendar(t, writeFeed(t, TeacherFeed(db, "fogel")))
 }
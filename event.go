@@ -0,0 +1,168 @@
+package psfacade
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	ical "github.com/fredcy/icalendar"
+	"regexp"
+	"time"
+)
+
+// Event is a calendar event, independent of how the calendar is serialized.
+type Event struct {
+	UID         string    `json:"uid"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	AllDay      bool      `json:"all_day"` // Start and End are dates, End exclusive
+	Summary     string    `json:"summary"`
+	Description string    `json:"description"`
+	Organizer   string    `json:"organizer,omitempty"` // email address
+	Attendee    string    `json:"attendee,omitempty"`  // email address
+}
+
+// generatedStamp matches the note of when a meeting event was generated.
+var generatedStamp = regexp.MustCompile(`#pscal_generated [-0-9T:]+`)
+
+// ContentHash returns a hash of the event that changes only when its
+// content does, ignoring the note of when it was generated.
+func (ev Event) ContentHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%t\x00%s\x00%s\x00%s\x00%s", ev.UID,
+		ev.Start.Format(time.RFC3339), ev.End.Format(time.RFC3339), ev.AllDay, ev.Summary,
+		generatedStamp.ReplaceAllString(ev.Description, ""), ev.Organizer, ev.Attendee)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Feed is a calendar and its events. The events channel can be read only once.
+type Feed struct {
+	ProdID      string
+	Name        string
+	Description string
+	Stamp       time.Time // when the feed was generated
+	Events      <-chan Event
+}
+
+// meetingFeed returns a Feed of events for the meetings.
+func meetingFeed(meetings <-chan Meeting, prodID, name, description string) Feed {
+	feed := Feed{ProdID: prodID, Name: name, Description: description, Stamp: time.Now()}
+	dateStamp := feed.Stamp.Format("2006-01-02T15:04")
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for mtg := range meetings {
+			email := fmt.Sprintf("%s@imsa.edu", mtg.LoginID)
+			events <- Event{
+				UID: fmt.Sprintf("PS-%s-%s-%s@imsa.edu",
+					mtg.CourseNumber, mtg.SectionNumber, ical.VDateTime(mtg.Start).String()),
+				Start:   mtg.Start,
+				End:     mtg.End(),
+				Summary: mtg.CourseName,
+				Description: fmt.Sprintf("%s (%s-%s) -- %s\n\n#pscal_generated %s",
+					mtg.CourseName, mtg.CourseNumber, mtg.SectionNumber, mtg.Room, dateStamp),
+				Organizer: email,
+				Attendee:  email,
+			}
+		}
+	}()
+	feed.Events = events
+	return feed
+}
+
+// TeacherFeed returns the Feed of the class meetings for the given teacher
+func TeacherFeed(db *sql.DB, loginid string) Feed {
+	return meetingFeed(GetTeacherSched(db, loginid),
+		fmt.Sprintf("-//imsa.edu//powerschool calendar for %s//EN", loginid),
+		fmt.Sprintf("%s@imsa.edu PowerSchool", loginid),
+		fmt.Sprintf("IMSA PowerSchool teacher calendar for %s", loginid))
+}
+
+// RoomFeed returns the Feed of the class meetings in the given room
+func RoomFeed(db *sql.DB, room string) Feed {
+	return meetingFeed(GetRoomSched(db, room),
+		fmt.Sprintf("-//imsa.edu//powerschool calendar for %s//EN", room),
+		fmt.Sprintf("Room %s for PowerSchool", room),
+		fmt.Sprintf("IMSA PowerSchool room calendar for %s", room))
+}
+
+// CalendarFeed returns the Feed of the PowerSchool common calendar (ABCDI
+// days, bell schedules, notes) as all-day events.
+func CalendarFeed(db *sql.DB) Feed {
+	return calendarDayFeed(GetCalendarDays(db))
+}
+
+// calendarDayFeed returns a Feed of all-day events for the calendar days.
+func calendarDayFeed(days <-chan CalDay) Feed {
+	feed := Feed{
+		ProdID:      "-//imsa.edu//powerschool calendar//EN",
+		Name:        "IMSA PowerSchool",
+		Description: "IMSA PowerSchool common calendar",
+		Stamp:       time.Now(),
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for day := range days {
+			summary := formatSummary(&day)
+			if summary == "" {
+				continue
+			}
+			events <- Event{
+				UID:         fmt.Sprintf("PS-Calendar-%s@imsa.edu", day.Date.Format("20060102")),
+				Start:       day.Date,
+				End:         day.Date.AddDate(0, 0, 1),
+				AllDay:      true,
+				Summary:     summary,
+				Description: formatDescription(&day),
+			}
+		}
+	}()
+	feed.Events = events
+	return feed
+}
+
+// Component returns the iCalendar VCALENDAR for the feed, reading all of its events.
+func (f Feed) Component() *ical.Component {
+	cal := ical.Component{}
+	cal.SetName("VCALENDAR")
+	cal.Set("VERSION", ical.VString("2.0"))
+	cal.Set("PRODID", ical.VString(f.ProdID))
+	cal.Set("METHOD", ical.VString("PUBLISH"))
+	cal.Set("CALSCALE", ical.VString("GREGORIAN"))
+	cal.Set("x-wr-calname", ical.VString(f.Name))
+	cal.Set("x-wr-caldesc", ical.VString(f.Description))
+	cal.Set("x-wr-timezone", ical.VString(calTimezoneID))
+	vtimezone := calTimezone()
+	cal.AddComponent(&vtimezone)
+
+	dtstamp := ical.VDateTime(f.Stamp)
+	for ev := range f.Events {
+		e := ical.Component{}
+		e.SetName("VEVENT")
+		if ev.AllDay {
+			e.Set("DTSTART", ical.VDate(ev.Start)).Add("VALUE", ical.VString("DATE"))
+			e.Set("DTEND", ical.VDate(ev.End)).Add("VALUE", ical.VString("DATE"))
+			// this pattern of start and end makes the event an all-day event that displays at top
+		} else {
+			e.Set("DTSTART", ical.VDateTime(ev.Start))
+			e.Set("DTEND", ical.VDateTime(ev.End))
+		}
+		e.Set("SUMMARY", ical.VString(ev.Summary))
+		e.Set("DESCRIPTION", ical.VString(ev.Description))
+		if ev.Organizer != "" {
+			organizer := ical.NewProperty("ORGANIZER", ical.VString("mailto:"+ev.Organizer))
+			e.AddProperty(&organizer)
+		}
+		e.Set("DTSTAMP", dtstamp)
+		e.Set("UID", ical.VString(ev.UID))
+		if ev.Attendee != "" {
+			attendee := ical.NewProperty("ATTENDEE", ical.VString("mailto:"+ev.Attendee))
+			attendee.Add("PARTSTAT", ical.VString("ACCEPTED"))
+			attendee.Add("ROLE", ical.VString("REQ-PARTICIPANT"))
+			e.AddProperty(&attendee)
+		}
+		cal.AddComponent(&e)
+	}
+	return &cal
+}
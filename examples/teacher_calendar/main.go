@@ -1,13 +1,28 @@
 package main
 
 import (
-	"fmt"
-	_ "github.com/fredcy/icalendar"
+	"database/sql"
+	"flag"
 	"github.com/fredcy/psfacade"
-	_ "log"
+	_ "github.com/mattn/go-oci8"
+	"log"
+	"os"
 )
 
+var conffile = flag.String("conf", "ps.conf", "PowerSchool connection config file")
+
 func main() {
-	cal := psfacade.TeacherCalendar("fogel")
-	fmt.Print(cal)
+	flag.Parse()
+	loginid := "fogel"
+	if flag.NArg() > 0 {
+		loginid = flag.Arg(0)
+	}
+	db, err := sql.Open("oci8", psfacade.MakeDSN(psfacade.GetConfig(*conffile)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := psfacade.WriteICalendar(os.Stdout, psfacade.TeacherFeed(db, loginid)); err != nil {
+		log.Fatal(err)
+	}
 }
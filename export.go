@@ -0,0 +1,244 @@
+package psfacade
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExportEntry describes one exported calendar file.
+type ExportEntry struct {
+	Kind    string    `json:"kind"` // "teacher", "room" or "calendar"
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // relative to the export directory
+	Events  int       `json:"events"`
+	Updated time.Time `json:"updated"` // when the file content last changed
+}
+
+// ExportIndex lists the exported calendar files.
+type ExportIndex struct {
+	Calendars []ExportEntry `json:"calendars"`
+}
+
+// teacherLoginids returns the loginids of the teachers with sections this year.
+func teacherLoginids(db *sql.DB) ([]string, error) {
+	query := `
+select distinct teachers.loginid
+from sections s
+join sectionteacher on s.id = sectionteacher.sectionid
+join teachers on sectionteacher.teacherid = teachers.id
+join terms on s.termid = terms.id and s.schoolid = terms.schoolid
+where s.schoolid = 140177 and terms.yearid = :yearid and teachers.loginid is not null
+order by teachers.loginid
+`
+	return queryStrings(db, query, CurrentYearID(db))
+}
+
+// queryStrings returns the single string column of the query results.
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// volatileICS matches the parts of generated calendars that change on every
+// run even though the calendar content has not.
+var volatileICS = regexp.MustCompile(`(?m)^DTSTAMP:.*\r\n|#pscal_generated [-0-9T:]+`)
+
+// sameCalendar reports whether two generated calendars have the same content,
+// ignoring time stamps.
+func sameCalendar(a, b []byte) bool {
+	unfold := func(data []byte) []byte {
+		data = bytes.ReplaceAll(data, []byte("\r\n "), nil)
+		return volatileICS.ReplaceAll(data, nil)
+	}
+	return bytes.Equal(unfold(a), unfold(b))
+}
+
+// writeIfChanged writes the data to the file unless the file already holds
+// the same content according to same. It writes a temporary file and renames
+// it into place so that readers never see a partial file. It reports whether
+// it wrote the file.
+func writeIfChanged(filename string, data []byte, same func(a, b []byte) bool) (bool, error) {
+	old, err := os.ReadFile(filename)
+	if err == nil && same(old, data) {
+		return false, nil
+	}
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), filename)
+}
+
+// exportCalendar writes one calendar into the export directory and returns its index entry.
+func exportCalendar(dir, kind, name, path string, feed Feed) (ExportEntry, error) {
+	var cal bytes.Buffer
+	if err := WriteICalendar(&cal, feed); err != nil {
+		return ExportEntry{}, err
+	}
+	filename := filepath.Join(dir, filepath.FromSlash(path))
+	changed, err := writeIfChanged(filename, cal.Bytes(), sameCalendar)
+	if err != nil {
+		return ExportEntry{}, err
+	}
+	entry := ExportEntry{Kind: kind, Name: name, Path: path,
+		Events: bytes.Count(cal.Bytes(), []byte("BEGIN:VEVENT"))}
+	if info, err := os.Stat(filename); err == nil {
+		entry.Updated = info.ModTime()
+	}
+	if changed {
+		log.Printf("exported %s (%d events)", filename, entry.Events)
+	}
+	return entry, nil
+}
+
+// exportHref returns the relative URL of the exported file at path, with
+// each segment escaped since room names may hold any character.
+func exportHref(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// removeStale removes the teacher and room calendar files in dir that are
+// not in the index, those of teachers and rooms no longer scheduled.
+func removeStale(dir string, index ExportIndex) error {
+	keep := map[string]bool{}
+	for _, entry := range index.Calendars {
+		keep[filepath.Join(dir, filepath.FromSlash(entry.Path))] = true
+	}
+	for _, sub := range []string{"u", "r"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			filename := filepath.Join(dir, sub, e.Name())
+			if e.IsDir() || filepath.Ext(filename) != ".ics" || keep[filename] {
+				continue
+			}
+			if err := os.Remove(filename); err != nil {
+				return err
+			}
+			log.Printf("removed %s, no longer exported", filename)
+		}
+	}
+	return nil
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{"href": exportHref}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>IMSA PowerSchool calendars</title></head>
+<body>
+<h1>IMSA PowerSchool calendars</h1>
+<table>
+<tr><th>Calendar</th><th>Kind</th><th>Events</th><th>Updated</th></tr>
+{{range .Calendars}}<tr><td><a href="{{href .Path}}">{{.Name}}</a></td><td>{{.Kind}}</td><td>{{.Events}}</td><td>{{.Updated.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// ExportCalendars writes the common calendar, the no-school calendar and the
+// calendar of every teacher and room into dir as cal.ics, noschool.ics,
+// u/{loginid}.ics and r/{room}.ics, along with index.json and index.html
+// listing them. Files whose content has not changed are left alone, and the
+// files of teachers and rooms no longer scheduled are removed.
+func ExportCalendars(db *sql.DB, dir string) (ExportIndex, error) {
+	index := ExportIndex{}
+	add := func(kind, name, path string, feed func() Feed) error {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			log.Printf("cannot export %s %q to a file, skipping it", kind, name)
+			return nil
+		}
+		entry, err := exportCalendar(dir, kind, name, path, feed())
+		if err != nil {
+			return fmt.Errorf("exporting %s %s: %v", kind, name, err)
+		}
+		index.Calendars = append(index.Calendars, entry)
+		return nil
+	}
+
+	if err := add("calendar", "IMSA PowerSchool", "cal.ics", func() Feed { return CalendarFeed(db) }); err != nil {
+		return index, err
+	}
+	if err := add("calendar", "IMSA No School", "noschool.ics", func() Feed { return NoSchoolFeed(db) }); err != nil {
+		return index, err
+	}
+	loginids, err := teacherLoginids(db)
+	if err != nil {
+		return index, err
+	}
+	for _, loginid := range loginids {
+		if err := add("teacher", loginid, "u/"+loginid+".ics", func() Feed { return TeacherFeed(db, loginid) }); err != nil {
+			return index, err
+		}
+	}
+	rooms, err := GetRoomNames(db)
+	if err != nil {
+		return index, err
+	}
+	for _, room := range rooms {
+		if err := add("room", room, "r/"+room+".ics", func() Feed { return RoomFeed(db, room) }); err != nil {
+			return index, err
+		}
+	}
+
+	if err := removeStale(dir, index); err != nil {
+		return index, err
+	}
+
+	indexJSON, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return index, err
+	}
+	if _, err := writeIfChanged(filepath.Join(dir, "index.json"), indexJSON, bytes.Equal); err != nil {
+		return index, err
+	}
+	var indexHTML bytes.Buffer
+	if err := exportIndexTemplate.Execute(&indexHTML, index); err != nil {
+		return index, err
+	}
+	_, err = writeIfChanged(filepath.Join(dir, "index.html"), indexHTML.Bytes(), bytes.Equal)
+	return index, err
+}
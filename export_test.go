@@ -0,0 +1,64 @@
+package psfacade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteIfChanged(t *testing.T) {
+	cal1 := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTAMP:20240901T080000Z\r\nDESCRIPTION:MAT321 #pscal_generated 2024-09-01T08:00\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	cal2 := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTAMP:20240902T090000\r\nDESCRIPTION:MAT321 #pscal_generated 2024-09-02T09:00\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	cal3 := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTAMP:20240902T090000\r\nDESCRIPTION:MAT322 #pscal_generated 2024-09-02T09:00\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if !sameCalendar([]byte(cal1), []byte(cal2)) {
+		t.Errorf("calendars differing only in time stamps should be the same")
+	}
+
+	filename := filepath.Join(t.TempDir(), "u", "fogel.ics")
+	for i, test := range []struct {
+		cal     string
+		changed bool
+	}{{cal1, true}, {cal2, false}, {cal3, true}} {
+		changed, err := writeIfChanged(filename, []byte(test.cal), sameCalendar)
+		if err != nil {
+			t.Fatalf("writeIfChanged: %v", err)
+		}
+		if changed != test.changed {
+			t.Errorf("write %d: changed = %v, expected %v", i, changed, test.changed)
+		}
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil || string(data) != cal3 {
+		t.Errorf("file content is %q (%v), expected %q", data, err, cal3)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(filename))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"cal.ics", "u/fogel.ics", "u/gone.ics", "r/A113.ics", "r/B101.ics", "r/notes.txt"} {
+		filename := filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := os.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := ExportIndex{Calendars: []ExportEntry{{Path: "cal.ics"}, {Path: "u/fogel.ics"}, {Path: "r/A113.ics"}}}
+	if err := removeStale(dir, index); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{"cal.ics": true, "u/fogel.ics": true, "u/gone.ics": false,
+		"r/A113.ics": true, "r/B101.ics": false, "r/notes.txt": true} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", path, exists, want)
+		}
+	}
+
+	if href := exportHref("r/Lab #2?.ics"); href != "r/Lab%20%232%3F.ics" {
+		t.Errorf("exportHref = %q", href)
+	}
+}
@@ -0,0 +1,309 @@
+package psfacade
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// icalComponentRules lists the properties that each component must have
+// exactly once and those that it may have at most once.
+var icalComponentRules = map[string]struct{ required, once []string }{
+	"VCALENDAR": {
+		required: []string{"PRODID", "VERSION"},
+		once:     []string{"CALSCALE", "METHOD"},
+	},
+	"VEVENT": {
+		required: []string{"UID", "DTSTAMP", "DTSTART"},
+		once:     []string{"DTEND", "DURATION", "SUMMARY", "DESCRIPTION", "ORGANIZER", "LOCATION", "CLASS", "STATUS", "TRANSP"},
+	},
+	"VTIMEZONE": {
+		required: []string{"TZID"},
+	},
+	"STANDARD": {
+		required: []string{"DTSTART", "TZOFFSETFROM", "TZOFFSETTO"},
+	},
+	"DAYLIGHT": {
+		required: []string{"DTSTART", "TZOFFSETFROM", "TZOFFSETTO"},
+	},
+}
+
+// icalParents gives the component that each known component must be nested in.
+var icalParents = map[string]string{
+	"VCALENDAR": "",
+	"VEVENT":    "VCALENDAR",
+	"VTIMEZONE": "VCALENDAR",
+	"STANDARD":  "VTIMEZONE",
+	"DAYLIGHT":  "VTIMEZONE",
+}
+
+// icalTextProperties are the single-valued TEXT properties whose escaping is checked.
+var icalTextProperties = []string{"PRODID", "UID", "SUMMARY", "DESCRIPTION", "LOCATION", "COMMENT",
+	"TZID", "TZNAME", "X-WR-CALNAME", "X-WR-CALDESC", "X-WR-TIMEZONE"}
+
+var (
+	icalNameRE      = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	icalDateRE      = regexp.MustCompile(`^[0-9]{8}$`)
+	icalDateTimeRE  = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z?$`)
+	icalUTCTimeRE   = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z$`)
+	icalUTCOffsetRE = regexp.MustCompile(`^[-+][0-9]{4}([0-9]{2})?$`)
+)
+
+// icalComponent is a component being checked by ValidateICalendar.
+type icalComponent struct {
+	name   string
+	line   int
+	props  map[string][]string // values by property name
+	params map[string][]string // parameters of the first instance by property name
+	subs   []string
+}
+
+// ValidateICalendar checks that data is a well-formed iCalendar stream and
+// returns the RFC 5545 violations it finds, citing line numbers. It
+// checks line endings and folding, content line syntax, TEXT escaping, date,
+// date-time and offset values, component nesting and the required and
+// single-instance properties of the components this package generates.
+func ValidateICalendar(data []byte) []error {
+	var errs []error
+	report := func(line int, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if line > 0 {
+			msg = fmt.Sprintf("line %d: %s", line, msg)
+		}
+		errs = append(errs, fmt.Errorf("%s", msg))
+	}
+
+	if !utf8.Valid(data) {
+		report(0, "not valid UTF-8")
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		report(0, "does not end with CRLF")
+	}
+
+	// unfold the physical lines into content lines, remembering where each starts
+	type contentLine struct {
+		num  int
+		text string
+	}
+	var lines []contentLine
+	for i, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		num := i + 1
+		if strings.ContainsAny(line, "\r\n") {
+			report(num, "line break without CRLF")
+		}
+		if len(line) > icalLineLen {
+			report(num, "line is %d octets long, more than %d", len(line), icalLineLen)
+		}
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if len(lines) == 0 {
+				report(num, "continuation line with nothing to continue")
+				continue
+			}
+			lines[len(lines)-1].text += line[1:]
+			continue
+		}
+		lines = append(lines, contentLine{num, line})
+	}
+
+	var stack []*icalComponent
+	calendars := 0
+	for _, cl := range lines {
+		name, params, value, err := parseContentLine(cl.text)
+		if err != nil {
+			report(cl.num, "%v", err)
+			continue
+		}
+		switch name {
+		case "BEGIN":
+			value = strings.ToUpper(value)
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1].name
+				stack[len(stack)-1].subs = append(stack[len(stack)-1].subs, value)
+			}
+			if want, known := icalParents[value]; known && want != parent {
+				report(cl.num, "%s inside %q, want inside %q", value, parent, want)
+			}
+			if value == "VCALENDAR" {
+				calendars++
+			}
+			stack = append(stack, &icalComponent{name: value, line: cl.num,
+				props: map[string][]string{}, params: map[string][]string{}})
+			continue
+		case "END":
+			value = strings.ToUpper(value)
+			if len(stack) == 0 || stack[len(stack)-1].name != value {
+				report(cl.num, "END:%s does not match an open component", value)
+				continue
+			}
+			errs = append(errs, checkComponent(stack[len(stack)-1])...)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if len(stack) == 0 {
+			report(cl.num, "property %s outside of any component", name)
+			continue
+		}
+		c := stack[len(stack)-1]
+		if _, ok := c.props[name]; !ok {
+			c.params[name] = params
+		}
+		c.props[name] = append(c.props[name], value)
+		if err := checkValue(name, params, value); err != nil {
+			report(cl.num, "%s: %v", name, err)
+		}
+	}
+	for _, c := range stack {
+		report(c.line, "%s is never ended", c.name)
+	}
+	if calendars != 1 {
+		report(0, "found %d VCALENDAR components, want 1", calendars)
+	}
+	return errs
+}
+
+// parseContentLine splits a content line into its upper-cased name, its
+// parameters (as NAME=value) and its value.
+func parseContentLine(line string) (name string, params []string, value string, err error) {
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return "", nil, "", fmt.Errorf("no ':' in %q", line)
+	}
+	name = line[:i]
+	if !icalNameRE.MatchString(name) {
+		return "", nil, "", fmt.Errorf("invalid property name %q", name)
+	}
+	name = strings.ToUpper(name)
+	rest := line[i:]
+	for rest[0] == ';' {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 || !icalNameRE.MatchString(rest[:eq]) {
+			return "", nil, "", fmt.Errorf("%s: invalid parameter in %q", name, line)
+		}
+		param := strings.ToUpper(rest[:eq]) + "="
+		rest = rest[eq+1:]
+		for {
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					return "", nil, "", fmt.Errorf("%s: unterminated quoted parameter value", name)
+				}
+				param += rest[:end+2]
+				rest = rest[end+2:]
+			} else {
+				end := strings.IndexAny(rest, `;:,"`)
+				if end < 0 {
+					return "", nil, "", fmt.Errorf("%s: no ':' after parameters", name)
+				}
+				if rest[end] == '"' {
+					return "", nil, "", fmt.Errorf("%s: quote inside parameter value", name)
+				}
+				param += rest[:end]
+				rest = rest[end:]
+			}
+			if rest == "" || rest[0] != ',' {
+				break
+			}
+			param += ","
+			rest = rest[1:]
+		}
+		if rest == "" {
+			return "", nil, "", fmt.Errorf("%s: no ':' after parameters", name)
+		}
+		params = append(params, param)
+	}
+	if rest[0] != ':' {
+		return "", nil, "", fmt.Errorf("%s: no ':' after parameters", name)
+	}
+	return name, params, rest[1:], nil
+}
+
+// checkValue checks the syntax of the property values this package generates.
+func checkValue(name string, params []string, value string) error {
+	for _, r := range value {
+		if r < 0x20 && r != '\t' || r == 0x7f {
+			return fmt.Errorf("control character %U in value", r)
+		}
+	}
+	switch name {
+	case "DTSTAMP":
+		if !icalUTCTimeRE.MatchString(value) {
+			return fmt.Errorf("DTSTAMP %q is not a UTC date-time", value)
+		}
+	case "DTSTART", "DTEND":
+		re := icalDateTimeRE
+		if slices.Contains(params, "VALUE=DATE") {
+			re = icalDateRE
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("invalid date or date-time %q", value)
+		}
+	case "TZOFFSETFROM", "TZOFFSETTO":
+		if !icalUTCOffsetRE.MatchString(value) {
+			return fmt.Errorf("invalid UTC offset %q", value)
+		}
+	}
+	if slices.Contains(icalTextProperties, name) {
+		for i := 0; i < len(value); i++ {
+			switch value[i] {
+			case ';', ',':
+				return fmt.Errorf("unescaped %q in TEXT value", value[i])
+			case '\\':
+				if i+1 == len(value) || !strings.ContainsRune(`\;,nN`, rune(value[i+1])) {
+					return fmt.Errorf("invalid escape in TEXT value")
+				}
+				i++
+			}
+		}
+	}
+	return nil
+}
+
+// checkComponent checks the properties and subcomponents of a completed component.
+func checkComponent(c *icalComponent) []error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("line %d: %s %s", c.line, c.name, fmt.Sprintf(format, args...)))
+	}
+	rules, known := icalComponentRules[c.name]
+	if !known {
+		return nil
+	}
+	for _, name := range rules.required {
+		if n := len(c.props[name]); n != 1 {
+			report("has %d %s properties, want 1", n, name)
+		}
+	}
+	for _, name := range rules.once {
+		if n := len(c.props[name]); n > 1 {
+			report("has %d %s properties, want at most 1", n, name)
+		}
+	}
+	switch c.name {
+	case "VCALENDAR":
+		if len(c.subs) == 0 {
+			report("has no components")
+		}
+	case "VTIMEZONE":
+		if !slices.Contains(c.subs, "STANDARD") && !slices.Contains(c.subs, "DAYLIGHT") {
+			report("has no STANDARD or DAYLIGHT component")
+		}
+	case "VEVENT":
+		if len(c.props["DTEND"]) > 0 && len(c.props["DURATION"]) > 0 {
+			report("has both DTEND and DURATION")
+		}
+		if len(c.props["DTEND"]) == 1 && len(c.props["DTSTART"]) == 1 {
+			start, end := c.props["DTSTART"][0], c.props["DTEND"][0]
+			if slices.Contains(c.params["DTSTART"], "VALUE=DATE") != slices.Contains(c.params["DTEND"], "VALUE=DATE") {
+				report("DTSTART and DTEND have different value types")
+			} else if len(start) == len(end) && end <= start {
+				report("DTEND %s is not after DTSTART %s", end, start)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,98 @@
+package psfacade
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkICalendar fails the test if data is not valid iCalendar.
+func checkICalendar(t *testing.T, data []byte) {
+	t.Helper()
+	for _, err := range ValidateICalendar(data) {
+		t.Error(err)
+	}
+	if t.Failed() {
+		t.Logf("calendar:\n%s", data)
+	}
+}
+
+// writeFeed returns the feed written as iCalendar.
+func writeFeed(t *testing.T, feed Feed) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, feed); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGeneratedCalendarsValid(t *testing.T) {
+	start := time.Date(2016, 9, 6, 8, 0, 0, 0, time.Local)
+	meetings := make(chan Meeting, 3)
+	meetings <- Meeting{LoginID: "fogel", Start: start, Duration: 55, CourseName: "Chemistry, Honors; Lab",
+		CourseNumber: "SCI100", SectionNumber: "1", Room: "A115"}
+	meetings <- Meeting{LoginID: "fogel", Start: start.Add(time.Hour), Duration: 0, CourseName: strings.Repeat("Écriture ", 20),
+		CourseNumber: "WLG300", SectionNumber: "2", Room: "B\r\n\x00201"}
+	meetings <- Meeting{LoginID: "fogel", Start: start.Add(2 * time.Hour), Duration: 50, CourseName: `Back\slash`,
+		CourseNumber: "MAT200", SectionNumber: "3", Room: "C1"}
+	close(meetings)
+	checkICalendar(t, writeFeed(t, meetingFeed(meetings, "-//imsa.edu//test//EN", "fogel, test", "teacher; test")))
+
+	days := make(chan CalDay, 3)
+	days <- CalDay{Date: time.Date(2016, 9, 6, 0, 0, 0, 0, time.UTC), InSession: true, CycleDay: "A", BellSchedule: "Late Start"}
+	days <- CalDay{Date: time.Date(2016, 9, 7, 0, 0, 0, 0, time.UTC), Note: "Labor Day, no classes;\nreturn Tuesday"}
+	days <- CalDay{Date: time.Date(2016, 9, 8, 0, 0, 0, 0, time.UTC), CycleDay: "Z"}
+	close(days)
+	checkICalendar(t, writeFeed(t, calendarDayFeed(days)))
+}
+
+func TestValidateICalendar(t *testing.T) {
+	valid := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:1\r\nDTSTAMP:20160901T080000Z\r\nDTSTART:20160906T080000\r\nDTEND:20160906T085500\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	if errs := ValidateICalendar([]byte(valid)); len(errs) != 0 {
+		t.Errorf("valid calendar gave %v", errs)
+	}
+
+	tests := []struct {
+		name, old, new, want string
+	}{
+		{"bare LF", "VERSION:2.0\r\n", "VERSION:2.0\n", "without CRLF"},
+		{"long line", "UID:1", "UID:" + strings.Repeat("x", 80), "octets long"},
+		{"unescaped comma", "UID:1", "UID:a,b", "unescaped"},
+		{"bad escape", "UID:1", `UID:a\tb`, "invalid escape"},
+		{"no UID", "UID:1\r\n", "", "UID"},
+		{"two DTSTAMPs", "DTSTAMP:20160901T080000Z\r\n", "DTSTAMP:20160901T080000Z\r\nDTSTAMP:20160901T080000Z\r\n", "DTSTAMP"},
+		{"no PRODID", "PRODID:-//test//EN\r\n", "", "PRODID"},
+		{"end before start", "DTEND:20160906T085500", "DTEND:20160906T075500", "not after"},
+		{"local DTSTAMP", "DTSTAMP:20160901T080000Z", "DTSTAMP:20160901T080000", "not a UTC"},
+		{"bad date", "DTSTART:20160906T080000", "DTSTART:2016-09-06", "invalid date"},
+		{"mismatched END", "END:VEVENT", "END:VTODO", "does not match"},
+		{"no colon", "VERSION:2.0", "VERSION", "no ':'"},
+	}
+	for _, test := range tests {
+		cal := strings.Replace(valid, test.old, test.new, 1)
+		errs := ValidateICalendar([]byte(cal))
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), test.want)
+		}
+		if !found {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, errs, test.want)
+		}
+	}
+}
+
+func TestWriteICalendarRequired(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, testFeed(Event{Start: testEvent.Start})); err == nil {
+		t.Error("no error for an event without a UID")
+	}
+	feed := testFeed(testEvent)
+	feed.ProdID = ""
+	if err := WriteICalendar(&buf, feed); err == nil {
+		t.Error("no error for a calendar without a PRODID")
+	}
+}
@@ -0,0 +1,189 @@
+package psfacade
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	icalDate     = "20060102"
+	icalDateTime = "20060102T150405"
+	icalLineLen  = 75 // octets, not counting the CRLF
+)
+
+// ICalWriter writes iCalendar (RFC 5545) content lines to an io.Writer as
+// they are produced. Lines end with CRLF and are folded at 75 octets without
+// splitting UTF-8 characters. The first error stops all further writes and is
+// reported by Err.
+type ICalWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewICalWriter returns an ICalWriter writing to w.
+func NewICalWriter(w io.Writer) *ICalWriter {
+	return &ICalWriter{w: w}
+}
+
+// Begin starts a component such as VCALENDAR or VEVENT.
+func (iw *ICalWriter) Begin(name string) {
+	iw.line("BEGIN:" + name)
+}
+
+// End ends a component.
+func (iw *ICalWriter) End(name string) {
+	iw.line("END:" + name)
+}
+
+// Property writes a property whose value is already in iCalendar form. Each
+// param is written as given, e.g. "VALUE=DATE".
+func (iw *ICalWriter) Property(name, value string, params ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, param := range params {
+		b.WriteString(";")
+		b.WriteString(param)
+	}
+	b.WriteString(":")
+	b.WriteString(value)
+	iw.line(b.String())
+}
+
+// Text writes a property with a TEXT value, escaping the value.
+func (iw *ICalWriter) Text(name, value string, params ...string) {
+	iw.Property(name, escapeText(value), params...)
+}
+
+// Flush passes buffered output on to the client if the underlying writer can
+// be flushed, as an http.ResponseWriter or bufio.Writer can.
+func (iw *ICalWriter) Flush() error {
+	if iw.err != nil {
+		return iw.err
+	}
+	switch f := iw.w.(type) {
+	case interface{ Flush() error }:
+		iw.err = f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return iw.err
+}
+
+// Err returns the first error encountered while writing.
+func (iw *ICalWriter) Err() error {
+	return iw.err
+}
+
+// line writes one content line, folding it as needed.
+func (iw *ICalWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+	var b strings.Builder
+	limit := icalLineLen
+	for len(s) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		if n == 0 {
+			n = limit // no rune start, so not UTF-8 to keep whole
+		}
+		b.WriteString(s[:n])
+		b.WriteString("\r\n ")
+		s = s[n:]
+		limit = icalLineLen - 1 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, iw.err = io.WriteString(iw.w, b.String())
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// escapeText escapes a TEXT property value. Line breaks of any kind become
+// \n, other control characters are dropped and invalid UTF-8 is replaced.
+func escapeText(s string) string {
+	s = textEscaper.Replace(s)
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// icalOffset formats a UTC offset in seconds as an iCalendar UTC-OFFSET value.
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// writeTimezone writes the VTIMEZONE of the calendars.
+func writeTimezone(iw *ICalWriter) {
+	iw.Begin("VTIMEZONE")
+	iw.Text("TZID", calTimezoneID)
+	for _, obs := range calTimezoneObservances {
+		iw.Begin(obs.name)
+		iw.Text("TZNAME", obs.tzname)
+		iw.Property("TZOFFSETFROM", icalOffset(obs.offsetFrom))
+		iw.Property("TZOFFSETTO", icalOffset(obs.offsetTo))
+		iw.Property("DTSTART", obs.dtstart.Format(icalDateTime))
+		iw.Property("RRULE", fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", obs.month, obs.byday))
+		iw.End(obs.name)
+	}
+	iw.End("VTIMEZONE")
+}
+
+// writeEvent writes the VEVENT for the event, with the extra TEXT
+// properties. It writes nothing and returns an error if the event lacks the
+// UID or start that RFC 5545 requires. DTEND is left out unless it is after
+// DTSTART, making a zero-length event.
+func writeEvent(iw *ICalWriter, ev Event, stamp string, extra map[string]string) error {
+	if ev.UID == "" {
+		return fmt.Errorf("event %q at %v has no UID", ev.Summary, ev.Start)
+	}
+	if ev.Start.IsZero() {
+		return fmt.Errorf("event %s has no start", ev.UID)
+	}
+	hasEnd := ev.End.After(ev.Start)
+	iw.Begin("VEVENT")
+	if ev.AllDay {
+		// this pattern of start and end makes the event an all-day event that displays at top
+		iw.Property("DTSTART", ev.Start.Format(icalDate), "VALUE=DATE")
+		if hasEnd {
+			iw.Property("DTEND", ev.End.Format(icalDate), "VALUE=DATE")
+		}
+	} else {
+		iw.Property("DTSTART", ev.Start.Format(icalDateTime))
+		if hasEnd {
+			iw.Property("DTEND", ev.End.Format(icalDateTime))
+		}
+	}
+	iw.Text("SUMMARY", ev.Summary)
+	iw.Text("DESCRIPTION", ev.Description)
+	if ev.Organizer != "" {
+		iw.Property("ORGANIZER", "mailto:"+ev.Organizer)
+	}
+	iw.Property("DTSTAMP", stamp)
+	iw.Text("UID", ev.UID)
+	if ev.Attendee != "" {
+		iw.Property("ATTENDEE", "mailto:"+ev.Attendee, "PARTSTAT=ACCEPTED", "ROLE=REQ-PARTICIPANT")
+	}
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		iw.Text(name, extra[name])
+	}
+	iw.End("VEVENT")
+	return iw.Err()
+}
@@ -0,0 +1,88 @@
+package psfacade
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICalWriterFolding(t *testing.T) {
+	var buf bytes.Buffer
+	iw := NewICalWriter(&buf)
+	long := strings.Repeat("Sección ", 30)
+	iw.Text("DESCRIPTION", long)
+	if err := iw.Err(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Fatalf("missing CRLF: %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("long line not folded: %q", out)
+	}
+	for i, line := range lines {
+		if len(line) > icalLineLen {
+			t.Errorf("line %d is %d octets", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a character: %q", i, line)
+		}
+		if i > 0 && line[0] != ' ' {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", "")
+	if unfolded != "DESCRIPTION:"+long {
+		t.Errorf("unfolded to %q", unfolded)
+	}
+}
+
+func TestICalWriterFoldingInvalidUTF8(t *testing.T) {
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		iw := NewICalWriter(&buf)
+		iw.Property("X-DATA", strings.Repeat("\x80", 200)) // continuation bytes only
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("folding invalid UTF-8 did not finish")
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	for i, line := range lines {
+		if len(line) > icalLineLen {
+			t.Errorf("line %d is %d octets", i, len(line))
+		}
+	}
+	if unfolded := strings.ReplaceAll(buf.String(), "\r\n ", ""); unfolded != "X-DATA:"+strings.Repeat("\x80", 200)+"\r\n" {
+		t.Errorf("unfolded to %q", unfolded)
+	}
+}
+
+func TestWriteICalendar(t *testing.T) {
+	allDay := Event{UID: "PS-Calendar-20160906@imsa.edu", AllDay: true,
+		Start: time.Date(2016, 9, 6, 0, 0, 0, 0, time.UTC), End: time.Date(2016, 9, 7, 0, 0, 0, 0, time.UTC),
+		Summary: "A day; Full Day, ok", Description: "first line\r\nsecond line"}
+	cal := string(writeFeed(t, testFeed(testEvent, allDay)))
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n",
+		"X-WR-TIMEZONE:America/Chicago\r\n",
+		"TZOFFSETFROM:-0600\r\n",
+		"DTSTART:20160906T080000\r\nDTEND:20160906T085500\r\n",
+		"ATTENDEE;PARTSTAT=ACCEPTED;ROLE=REQ-PARTICIPANT:mailto:fogel@imsa.edu\r\n",
+		"DTSTART;VALUE=DATE:20160906\r\nDTEND;VALUE=DATE:20160907\r\n",
+		"SUMMARY:A day\\; Full Day\\, ok\r\nDESCRIPTION:first line\\nsecond line\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(cal, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, cal)
+		}
+	}
+	checkICalendar(t, []byte(cal))
+}
@@ -0,0 +1,80 @@
+package psfacade
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Happening is what is going on for a teacher, room or student at a time:
+// the meeting under way, the next one to start and the bell schedule period.
+type Happening struct {
+	Time    time.Time `json:"time"`
+	Period  string    `json:"period"` // name of the current period, if any
+	Current *Meeting  `json:"current"`
+	Next    *Meeting  `json:"next"`
+}
+
+// HappeningAt returns what is happening at t among the meetings, reading
+// them all. The bell schedule of t's day, if it has one, names the period.
+func HappeningAt(meetings <-chan Meeting, sched *BellSchedule, t time.Time) Happening {
+	h := Happening{Time: t}
+	for m := range meetings {
+		m := m
+		switch {
+		case !t.Before(m.Start) && t.Before(m.End()):
+			if h.Current == nil {
+				h.Current = &m
+			}
+		case m.Start.After(t):
+			if h.Next == nil || m.Start.Before(h.Next.Start) {
+				h.Next = &m
+			}
+		}
+	}
+	if sched != nil {
+		if p, ok := sched.Period(t); ok {
+			h.Period = p.Name
+		}
+	}
+	return h
+}
+
+// WithoutCourses returns the happening with only the times, periods and
+// rooms of its meetings, leaving out the courses, sections, terms and
+// teachers that would reveal a student's schedule.
+func (h Happening) WithoutCourses() Happening {
+	strip := func(m *Meeting) *Meeting {
+		if m == nil {
+			return nil
+		}
+		return &Meeting{Start: m.Start, Duration: m.Duration, Room: m.Room, PeriodStart: m.PeriodStart,
+			PeriodEnd: m.PeriodEnd, CycleDay: m.CycleDay, BellSchedule: m.BellSchedule}
+	}
+	h.Current, h.Next = strip(h.Current), strip(h.Next)
+	return h
+}
+
+// GetHappening returns what is happening at t in the schedule of the kind
+// of thing, "teacher" (by loginid), "room" or "student" (by student number),
+// with the given id. It returns false for an unknown kind.
+func GetHappening(db *sql.DB, kind, id string, t time.Time) (Happening, bool) {
+	var meetings <-chan Meeting
+	switch kind {
+	case "teacher":
+		meetings = GetTeacherSched(db, id)
+	case "room":
+		meetings = GetRoomSched(db, id)
+	case "student":
+		meetings = GetStudentSched(db, id)
+	default:
+		return Happening{}, false
+	}
+	if loc, err := time.LoadLocation(calTimezoneID); err == nil {
+		t = t.In(loc) // for the school's date of t
+	}
+	var sched *BellSchedule
+	if bs, ok := GetBellSchedule(db, t); ok {
+		sched = &bs
+	}
+	return HappeningAt(meetings, sched, t), true
+}
@@ -0,0 +1,37 @@
+package psfacade
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHappeningAt(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 9, day, hour, minute, 0, 0, time.UTC)
+	}
+	meetings := func() <-chan Meeting {
+		ch := make(chan Meeting, 3)
+		ch <- Meeting{CourseNumber: "MAT321", Start: at(3, 8, 0), Duration: 75}
+		ch <- Meeting{CourseNumber: "PHY201", Start: at(3, 10, 0), Duration: 50}
+		ch <- Meeting{CourseNumber: "CHE101", Start: at(4, 8, 0), Duration: 50}
+		close(ch)
+		return ch
+	}
+	sched := &BellSchedule{Periods: []BellPeriod{{Name: "Mod 1", Start: at(3, 8, 0), End: at(3, 8, 50)}}}
+
+	h := HappeningAt(meetings(), sched, at(3, 8, 30))
+	if h.Current == nil || h.Current.CourseNumber != "MAT321" || h.Next == nil || h.Next.CourseNumber != "PHY201" || h.Period != "Mod 1" {
+		t.Errorf("at 8:30: %+v", h)
+	}
+	h = HappeningAt(meetings(), nil, at(3, 11, 0))
+	if h.Current != nil || h.Next == nil || h.Next.CourseNumber != "CHE101" || h.Period != "" {
+		t.Errorf("at 11:00: %+v", h)
+	}
+	if stripped := h.WithoutCourses(); stripped.Next.CourseNumber != "" || !stripped.Next.Start.Equal(at(4, 8, 0)) || h.Next.CourseNumber != "CHE101" {
+		t.Errorf("without courses: %+v", stripped.Next)
+	}
+	h = HappeningAt(meetings(), nil, at(4, 9, 0))
+	if h.Current != nil || h.Next != nil {
+		t.Errorf("after the last meeting: %+v", h)
+	}
+}
@@ -0,0 +1,221 @@
+package psfacade
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// Redacted replaces the value of a Student field that a role may know exists
+// but may not see.
+const Redacted = "REDACTED"
+
+// StudentPolicy defines which Student fields each role may see. Fields are
+// named as in StudentFieldNames, plus the basic fields number, first_name,
+// last_name, room and username, and schedule for the courses and sections
+// of the student's class meetings. The name "*" stands for all fields.
+type StudentPolicy struct {
+	DefaultRole string // role of clients without a role defined here; make it the most restrictive
+	Roles       map[string]RolePolicy
+	Sensitive   []string // fields whose access is logged; defaults to the built-in sensitive fields
+}
+
+// RolePolicy lists the fields visible to a role. Fields that are neither
+// visible nor redacted are omitted.
+type RolePolicy struct {
+	Fields []string // fields shown as is
+	Redact []string // fields shown as Redacted
+}
+
+var basicStudentFields = []string{"number", "first_name", "last_name", "room", "username"}
+
+// DefaultStudentPolicy returns the policy used when no policy file is given:
+// every client sees all but the sensitive fields.
+func DefaultStudentPolicy() StudentPolicy {
+	fields := append([]string{}, basicStudentFields...)
+	for _, f := range studentFields {
+		if !f.sensitive {
+			fields = append(fields, f.name)
+		}
+	}
+	return StudentPolicy{
+		DefaultRole: "default",
+		Roles:       map[string]RolePolicy{"default": {Fields: fields}},
+	}
+}
+
+// GetStudentPolicy reads the student privacy policy file
+func GetStudentPolicy(filename string) StudentPolicy {
+	policyfile, err := os.Open(filename)
+	if err != nil {
+		log.Panicf("cannot open policy file (%v)", filename)
+	}
+	defer policyfile.Close()
+	log.Printf("Reading %s for student privacy policy", filename)
+	decoder := json.NewDecoder(policyfile)
+	decoder.DisallowUnknownFields() // such as the Clients of old policies, which granted roles by address
+	policy := StudentPolicy{}
+	jerr := decoder.Decode(&policy)
+	if jerr != nil {
+		log.Panicf("Cannot decode json file %v: %v", filename, jerr)
+	}
+	if _, ok := policy.Roles[policy.DefaultRole]; !ok {
+		log.Panicf("policy file %v: no definition for default role %q", filename, policy.DefaultRole)
+	}
+	return policy
+}
+
+// RoleFor returns the role of a principal (nil if anonymous), which is the
+// first of its roles defined in the policy. Anonymous principals and those
+// with no such role get the default role, whatever the client address:
+// behind a proxy every request comes from localhost.
+func (p StudentPolicy) RoleFor(principal *Principal) string {
+	if principal != nil {
+		for _, role := range principal.Roles {
+			if _, ok := p.Roles[role]; ok {
+				return role
+			}
+		}
+	}
+	return p.DefaultRole
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == "*" || n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Visible reports whether the role may see the named field.
+func (p StudentPolicy) Visible(role, field string) bool {
+	return contains(p.Roles[role].Fields, field)
+}
+
+func (p StudentPolicy) redacted(role, field string) bool {
+	return !p.Visible(role, field) && contains(p.Roles[role].Redact, field)
+}
+
+func (p StudentPolicy) sensitive(field string) bool {
+	if p.Sensitive != nil {
+		return contains(p.Sensitive, field)
+	}
+	return IsSensitiveStudentField(field)
+}
+
+// VisibleFields returns those of the requested optional fields that the
+// role may see, which are the only ones worth querying.
+func (p StudentPolicy) VisibleFields(role string, requested []string) []string {
+	var fields []string
+	for _, f := range requested {
+		if p.Visible(role, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// studentFieldValue returns a pointer to the named field of the student.
+func studentFieldValue(s *Student, name string) *string {
+	switch name {
+	case "number":
+		return &s.Number
+	case "first_name":
+		return &s.FirstName
+	case "last_name":
+		return &s.LastName
+	case "room":
+		return &s.Room
+	case "username":
+		return &s.Username
+	}
+	if f, ok := lookupStudentField(name); ok {
+		return f.dest(s)
+	}
+	return nil
+}
+
+// StudentEncoder writes Student values as JSON after applying the policy for
+// a role, and keeps track of the sensitive fields it reveals.
+type StudentEncoder struct {
+	policy    StudentPolicy
+	role      string
+	client    string
+	requested []string
+	enc       *json.Encoder
+	revealed  map[string]int // sensitive field -> number of students
+	count     int
+}
+
+// NewEncoder returns an encoder of students for the given role and client.
+// Requested names the optional fields the client asked for; redacted
+// optional fields are shown only if requested.
+func (p StudentPolicy) NewEncoder(w io.Writer, role, client string, requested []string) *StudentEncoder {
+	return &StudentEncoder{
+		policy:    p,
+		role:      role,
+		client:    client,
+		requested: requested,
+		enc:       json.NewEncoder(w),
+		revealed:  make(map[string]int),
+	}
+}
+
+// Apply clears the fields of s that the role may not see and redacts those
+// it may only know about.
+func (e *StudentEncoder) Apply(s *Student) {
+	fields := append(append([]string{}, basicStudentFields...), StudentFieldNames()...)
+	for _, name := range fields {
+		value := studentFieldValue(s, name)
+		switch {
+		case e.policy.Visible(e.role, name):
+			if *value != "" && e.policy.sensitive(name) {
+				e.revealed[name]++
+			}
+		case e.policy.redacted(e.role, name) && (contains(basicStudentFields, name) || contains(e.requested, name)):
+			*value = Redacted
+		default:
+			*value = ""
+		}
+	}
+}
+
+// Encode writes the student, as permitted by the policy, as JSON.
+func (e *StudentEncoder) Encode(s Student) error {
+	e.Apply(&s)
+	e.count++
+	return e.enc.Encode(&s)
+}
+
+// Redact returns a channel of the students with the policy applied, for
+// output in formats other than JSON.
+func (e *StudentEncoder) Redact(students <-chan Student) <-chan Student {
+	redacted := make(chan Student)
+	go func() {
+		defer close(redacted)
+		for s := range students {
+			e.Apply(&s)
+			e.count++
+			redacted <- s
+		}
+	}()
+	return redacted
+}
+
+// Close logs the sensitive fields revealed through the encoder.
+func (e *StudentEncoder) Close() {
+	if len(e.revealed) == 0 {
+		return
+	}
+	var fields []string
+	for f := range e.revealed {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	log.Printf("student data access: client=%v role=%v sensitive fields=%v students=%d",
+		e.client, e.role, fields, e.count)
+}
@@ -0,0 +1,145 @@
+package psfacade
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Room is a room used by sections in the current school year.
+type Room struct {
+	Name     string  `json:"room"`
+	Sections int     `json:"sections"`
+	Hours    float64 `json:"hours"` // total of the year's class meetings
+}
+
+// GetRoomNames returns the rooms of the sections this year.
+func GetRoomNames(db *sql.DB) ([]string, error) {
+	query := `
+select distinct s.room
+from sections s
+join terms on s.termid = terms.id and s.schoolid = terms.schoolid
+where s.schoolid = 140177 and terms.yearid = :yearid and s.room is not null
+order by s.room
+`
+	return queryStrings(db, query, CurrentYearID(db))
+}
+
+// GetRooms returns a channel of the rooms of the sections this year, with
+// the number of sections in each and the hours of their meetings.
+func GetRooms(db *sql.DB) <-chan Room {
+	filter, args := rules.meetingFilter(3)
+	query := fmt.Sprintf(`
+    with
+    sm1 as (select sm.sectionid, sm.cycle_day_letter, min(sm.period_number) period_min from section_meeting sm group by sectionid, cycle_day_letter),
+    sm2 as (select sm.sectionid, sm.cycle_day_letter, max(sm.period_number) period_max from section_meeting sm group by sectionid, cycle_day_letter),
+    rooms as (
+      select s.room, count(*) sections
+      from sections s
+      join terms on s.termid = terms.id and s.schoolid = terms.schoolid
+      where s.schoolid = 140177 and terms.yearid = :yearid and s.room is not null
+      group by s.room
+    ),
+    usage as (
+      select s.room, sum(bsi2.end_time - bsi1.start_time) seconds
+      from sections s
+      join teachers on s.teacher = teachers.id
+      join sm1 on s.id = sm1.sectionid
+      join sm2 on s.id = sm2.sectionid and sm1.cycle_day_letter = sm2.cycle_day_letter
+      join terms on s.termid = terms.id and s.schoolid = terms.schoolid
+      join period period1 on sm1.period_min = period1.period_number and s.schoolid = period1.schoolid and terms.yearid = period1.year_id
+      join period period2 on sm2.period_max = period2.period_number and s.schoolid = period2.schoolid and terms.yearid = period2.year_id
+      join cycle_day on sm1.cycle_day_letter = cycle_day.letter and terms.yearid = cycle_day.year_id and cycle_day.schoolid = terms.schoolid
+      join calendar_day cd on cd.schoolid = s.schoolid and cd.date_value between terms.firstday and terms.lastday and cd.cycle_day_id = cycle_day.id
+      join bell_schedule_items bsi1 on period1.id = bsi1.period_id and cd.bell_schedule_id = bsi1.bell_schedule_id
+      join bell_schedule_items bsi2 on period2.id = bsi2.period_id and cd.bell_schedule_id = bsi2.bell_schedule_id
+      where s.schoolid = 140177
+      and terms.yearid = :yearid2
+      and %s
+      and teachers.loginid is not null
+      group by s.room
+    )
+    select rooms.room, rooms.sections, nvl(usage.seconds, 0)
+    from rooms
+    left outer join usage on rooms.room = usage.room
+    order by rooms.room
+`, filter)
+	yearid := CurrentYearID(db)
+	rows, err := db.Query(query, append([]interface{}{yearid, yearid}, args...)...)
+	if err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	rooms := make(chan Room)
+	go func() {
+		defer rows.Close()
+		defer close(rooms)
+		for rows.Next() {
+			room := Room{}
+			var seconds int
+			if err := rows.Scan(&room.Name, &room.Sections, &seconds); err != nil {
+				log.Panic("rows.Scan: ", err)
+			}
+			room.Hours = float64(seconds) / 3600
+			rooms <- room
+		}
+		if err := rows.Err(); err != nil {
+			log.Panic("rows.Err ", err)
+		}
+	}()
+	return rooms
+}
+
+// SuggestRooms returns up to n of the rooms most like name, for when name
+// is not a room: those it is a prefix of and those a few edits away.
+func SuggestRooms(rooms []string, name string, n int) []string {
+	type candidate struct {
+		room     string
+		distance int
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	limit := len(name)/3 + 1
+	var candidates []candidate
+	for _, room := range rooms {
+		lower := strings.ToLower(room)
+		d := editDistance(name, lower)
+		if name != "" && strings.HasPrefix(lower, name) {
+			d = 0
+		}
+		if d <= limit {
+			candidates = append(candidates, candidate{room, d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	var suggestions []string
+	for _, c := range candidates {
+		if len(suggestions) == n {
+			break
+		}
+		suggestions = append(suggestions, c.room)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range ra {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			cur[j+1] = min(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,25 @@
+package psfacade
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSuggestRooms(t *testing.T) {
+	rooms := []string{"A113", "A115", "B113", "Gym", "Lecture Hall"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a113 ", "[A113 A115 B113]"},
+		{"A1", "[A113 A115]"},
+		{"gmy", "[Gym]"},
+		{"lecture", "[Lecture Hall]"},
+		{"C900", "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(SuggestRooms(rooms, test.name, 3)); got != test.want {
+			t.Errorf("SuggestRooms(%q) = %s, expected %s", test.name, got, test.want)
+		}
+	}
+}
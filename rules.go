@@ -0,0 +1,94 @@
+package psfacade
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Rules defines the site-specific choices about which PowerSchool data to
+// show in the generated calendars.
+type Rules struct {
+	CycleDays             []string // cycle day abbreviations to display in the common calendar
+	SuppressBellSchedules []string // bell schedule name prefixes not worth showing in a summary
+	ExcludedCourses       []string // course numbers never included in schedules
+	PeriodCutoff          int      // periods numbered at or above this are not class meetings
+}
+
+// DefaultRules returns the rules used when no rules file is given.
+func DefaultRules() Rules {
+	return Rules{
+		CycleDays:             []string{"A", "B", "C", "D", "I"},
+		SuppressBellSchedules: []string{"Full Day"},
+		// Res Life, LASSI, Nav, LEAD, I-Day Attendance
+		ExcludedCourses: []string{"SLD100", "SLD102", "SLD200", "SLD210", "SLD600"},
+		PeriodCutoff:    21,
+	}
+}
+
+var rules = DefaultRules()
+
+// GetRules reads the rules file. Any value not given in the file keeps its default.
+func GetRules(filename string) Rules {
+	rulesfile, err := os.Open(filename)
+	if err != nil {
+		log.Panicf("cannot open rules file (%v)", filename)
+	}
+	defer rulesfile.Close()
+	log.Printf("Reading %s for calendar rules", filename)
+	decoder := json.NewDecoder(rulesfile)
+	r := DefaultRules()
+	jerr := decoder.Decode(&r)
+	if jerr != nil {
+		log.Panicf("Cannot decode json file %v: %v", filename, jerr)
+	}
+	return r
+}
+
+// SetRules replaces the rules applied by all of the calendar and schedule generators.
+func SetRules(r Rules) {
+	rules = r
+}
+
+// showCycleDay reports whether the cycle day should appear in a calendar summary
+func (r Rules) showCycleDay(cycleDay string) bool {
+	for _, cd := range r.CycleDays {
+		if cd == cycleDay {
+			return true
+		}
+	}
+	return false
+}
+
+// showBellSched reports whether the bell schedule name should appear in a calendar summary
+func (r Rules) showBellSched(bellSched string) bool {
+	if bellSched == "" {
+		return false
+	}
+	for _, prefix := range r.SuppressBellSchedules {
+		if strings.HasPrefix(bellSched, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// meetingFilter returns the SQL conditions that apply the rules to a section
+// meeting query (with period1 and s as in GetTeacherSched), along with the
+// values for the bind variables in those conditions. The bind variables are
+// numbered starting from firstArg.
+func (r Rules) meetingFilter(firstArg int) (string, []interface{}) {
+	args := []interface{}{r.PeriodCutoff}
+	filter := fmt.Sprintf("period1.period_number < :%d", firstArg)
+	if len(r.ExcludedCourses) > 0 {
+		var binds []string
+		for i, course := range r.ExcludedCourses {
+			binds = append(binds, fmt.Sprintf(":%d", firstArg+1+i))
+			args = append(args, course)
+		}
+		filter += fmt.Sprintf("\n    and s.course_number not in (%s)", strings.Join(binds, ", "))
+	}
+	return filter, args
+}
@@ -0,0 +1,151 @@
+package psfacade
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SchoolCalendar is the calendar days of the school year, in date order,
+// for questions about particular dates.
+type SchoolCalendar struct {
+	Days []CalDay
+}
+
+// NewSchoolCalendar returns the SchoolCalendar of the days, reading them all.
+func NewSchoolCalendar(days <-chan CalDay) *SchoolCalendar {
+	sc := &SchoolCalendar{}
+	for day := range days {
+		sc.Days = append(sc.Days, day)
+	}
+	sort.Slice(sc.Days, func(i, j int) bool { return sc.Days[i].Date.Before(sc.Days[j].Date) })
+	return sc
+}
+
+// GetSchoolCalendar returns the SchoolCalendar of the days of the school
+// year, from its first day through its last.
+func GetSchoolCalendar(db *sql.DB) *SchoolCalendar {
+	year := currentYearTerm(db)
+	return NewSchoolCalendar(getCalendarDays(db, year.FirstDay, year.LastDay))
+}
+
+// civilDate returns the calendar date of t as a time at midnight UTC, the
+// form of CalDay dates.
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// index returns the index of the first day on or after the date's calendar date.
+func (sc *SchoolCalendar) index(date time.Time) int {
+	date = civilDate(date)
+	return sort.Search(len(sc.Days), func(i int) bool { return !sc.Days[i].Date.Before(date) })
+}
+
+// Day returns the calendar day of the date, or false if the date is not in
+// the school calendar.
+func (sc *SchoolCalendar) Day(date time.Time) (CalDay, bool) {
+	i := sc.index(date)
+	if i < len(sc.Days) && sc.Days[i].Date.Equal(civilDate(date)) {
+		return sc.Days[i], true
+	}
+	return CalDay{}, false
+}
+
+// InSession reports whether school is in session on the date. The second
+// result is false if the date is not in the school calendar.
+func (sc *SchoolCalendar) InSession(date time.Time) (inSession, known bool) {
+	day, known := sc.Day(date)
+	return day.InSession, known
+}
+
+// NextInstructionalDay returns the first day after the date on which school
+// is in session, or false if there is none left in the school calendar.
+func (sc *SchoolCalendar) NextInstructionalDay(date time.Time) (CalDay, bool) {
+	for _, day := range sc.Days[sc.index(civilDate(date).AddDate(0, 0, 1)):] {
+		if day.InSession {
+			return day, true
+		}
+	}
+	return CalDay{}, false
+}
+
+// NoSchoolDays returns the days on which school is not in session: the
+// holidays and other non-instructional weekdays, and weekend days only if
+// they have a note.
+func (sc *SchoolCalendar) NoSchoolDays() []CalDay {
+	var days []CalDay
+	for _, day := range sc.Days {
+		weekend := day.Date.Weekday() == time.Saturday || day.Date.Weekday() == time.Sunday
+		if !day.InSession && (!weekend || day.Note != "") {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// NoSchoolFeed returns the Feed of the days without school as all-day
+// events, with the day's note as the summary.
+func NoSchoolFeed(db *sql.DB) Feed {
+	return noSchoolFeed(GetSchoolCalendar(db).NoSchoolDays())
+}
+
+func noSchoolFeed(days []CalDay) Feed {
+	feed := Feed{
+		ProdID:      "-//imsa.edu//powerschool no school calendar//EN",
+		Name:        "IMSA No School",
+		Description: "Days without classes in the IMSA PowerSchool calendar",
+		Stamp:       time.Now(),
+	}
+	events := make(chan Event, len(days))
+	for _, day := range days {
+		summary := day.Note
+		if summary == "" {
+			summary = "No school"
+		}
+		events <- Event{
+			UID:         fmt.Sprintf("PS-NoSchool-%s@imsa.edu", day.Date.Format("20060102")),
+			Start:       day.Date,
+			End:         day.Date.AddDate(0, 0, 1),
+			AllDay:      true,
+			Summary:     summary,
+			Description: formatDescription(&day),
+		}
+	}
+	close(events)
+	feed.Events = events
+	return feed
+}
+
+// CycleDay returns the cycle day letter of the date, or false if the date
+// is not in the school calendar or has no cycle day.
+func (sc *SchoolCalendar) CycleDay(date time.Time) (string, bool) {
+	day, ok := sc.Day(date)
+	return day.CycleDay, ok && day.CycleDay != ""
+}
+
+// CycleDays returns the days in session from the date from up to but not
+// including to with the given cycle day letter, or with any letter if the
+// letter is empty.
+func (sc *SchoolCalendar) CycleDays(letter string, from, to time.Time) []CalDay {
+	var days []CalDay
+	if !from.Before(to) {
+		return days
+	}
+	for _, day := range sc.Days[sc.index(from):sc.index(to)] {
+		if day.InSession && day.CycleDay != "" && (letter == "" || day.CycleDay == letter) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// CycleDayCounts returns the number of days in session of each cycle day
+// letter from the date from up to but not including to.
+func (sc *SchoolCalendar) CycleDayCounts(from, to time.Time) map[string]int {
+	counts := map[string]int{}
+	for _, day := range sc.CycleDays("", from, to) {
+		counts[day.CycleDay]++
+	}
+	return counts
+}
@@ -0,0 +1,71 @@
+package psfacade
+
+import (
+	"testing"
+	"time"
+)
+
+func testSchoolCalendar() *SchoolCalendar {
+	date := func(day int) time.Time { return time.Date(2016, 9, day, 0, 0, 0, 0, time.UTC) }
+	days := make(chan CalDay, 8)
+	days <- CalDay{Date: date(5), Note: "Labor Day"} // Monday
+	days <- CalDay{Date: date(2), InSession: true, CycleDay: "D"}
+	days <- CalDay{Date: date(3)} // Saturday
+	days <- CalDay{Date: date(4)}
+	days <- CalDay{Date: date(6), InSession: true, CycleDay: "A"}
+	days <- CalDay{Date: date(10), Note: "Family Weekend"}
+	close(days)
+	return NewSchoolCalendar(days)
+}
+
+func TestSchoolCalendar(t *testing.T) {
+	sc := testSchoolCalendar()
+	labor := time.Date(2016, 9, 5, 14, 30, 0, 0, time.Local)
+
+	if in, known := sc.InSession(labor); in || !known {
+		t.Errorf("InSession(Labor Day) = %v, %v", in, known)
+	}
+	if in, known := sc.InSession(labor.AddDate(0, 0, 1)); !in || !known {
+		t.Errorf("InSession(Sept 6) = %v, %v", in, known)
+	}
+	if _, known := sc.InSession(labor.AddDate(0, 1, 0)); known {
+		t.Errorf("InSession(Oct 5) known")
+	}
+	if next, ok := sc.NextInstructionalDay(time.Date(2016, 9, 2, 8, 0, 0, 0, time.Local)); !ok || next.Date.Day() != 6 {
+		t.Errorf("NextInstructionalDay(Sept 2) = %v, %v", next.Date, ok)
+	}
+	if next, ok := sc.NextInstructionalDay(labor.AddDate(0, 0, 1)); ok {
+		t.Errorf("NextInstructionalDay(Sept 6) = %v, expected none", next.Date)
+	}
+
+	var got []int
+	for _, day := range sc.NoSchoolDays() {
+		got = append(got, day.Date.Day())
+	}
+	if len(got) != 2 || got[0] != 5 || got[1] != 10 {
+		t.Errorf("NoSchoolDays = %v, expected [5 10]", got)
+	}
+	checkICalendar(t, writeFeed(t, noSchoolFeed(sc.NoSchoolDays())))
+}
+
+func TestCycleDays(t *testing.T) {
+	sc := testSchoolCalendar()
+	date := func(day int) time.Time { return time.Date(2016, 9, day, 0, 0, 0, 0, time.UTC) }
+
+	if letter, ok := sc.CycleDay(date(6)); !ok || letter != "A" {
+		t.Errorf("CycleDay(Sept 6) = %q, %v", letter, ok)
+	}
+	if letter, ok := sc.CycleDay(date(5)); ok {
+		t.Errorf("CycleDay(Labor Day) = %q", letter)
+	}
+	if days := sc.CycleDays("A", date(1), date(30)); len(days) != 1 || !days[0].Date.Equal(date(6)) {
+		t.Errorf("CycleDays(A) = %v", days)
+	}
+	if days := sc.CycleDays("", date(3), date(6)); len(days) != 0 {
+		t.Errorf("CycleDays(Sept 3-5) = %v", days)
+	}
+	counts := sc.CycleDayCounts(date(1), date(30))
+	if len(counts) != 2 || counts["A"] != 1 || counts["D"] != 1 {
+		t.Errorf("CycleDayCounts = %v", counts)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarFormats maps the format parameter values to content types.
+var calendarFormats = map[string]string{
+	"ics":  psfacade.ICalendarContentType,
+	"jcal": psfacade.JCalContentType,
+	"json": psfacade.EventsContentType,
+}
+
+// calendarContentType returns the content type chosen by the format
+// parameter or else by the Accept header. iCalendar is the default.
+func calendarContentType(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		ct, ok := calendarFormats[format]
+		return ct, ok
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, psfacade.JCalContentType):
+		return psfacade.JCalContentType, true
+	case strings.Contains(accept, psfacade.EventsContentType):
+		return psfacade.EventsContentType, true
+	}
+	return psfacade.ICalendarContentType, true
+}
+
+// started is when the server started, the Last-Modified time of the
+// calendar feeds.
+var started = time.Now()
+
+// calhandler serves the calendar feed produced by the generator as
+// iCalendar, jCal or a JSON list of events.
+func calhandler(generator func(*http.Request, *sql.DB) psfacade.Feed) dbfunc {
+	return func(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+		contentType, ok := calendarContentType(r)
+		if !ok {
+			http.Error(w, "unsupported format", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("public,max-age=%d", config.MaxAge))
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("Last-Modified", started.UTC().Format(http.TimeFormat))
+
+		feed := generator(r, db)
+		var err error
+		switch contentType {
+		case psfacade.JCalContentType:
+			err = psfacade.WriteJCal(w, feed)
+		case psfacade.EventsContentType:
+			err = psfacade.WriteEventsJSON(w, feed)
+		default:
+			err = psfacade.WriteICalendar(w, feed)
+		}
+		if err != nil {
+			log.Printf("writing %v: %v", r.URL, err)
+		}
+	}
+}
+
+func usergenerator(r *http.Request, db *sql.DB) psfacade.Feed {
+	return psfacade.TeacherFeed(db, mux.Vars(r)["loginid"])
+}
+
+func roomgenerator(r *http.Request, db *sql.DB) psfacade.Feed {
+	return psfacade.RoomFeed(db, mux.Vars(r)["room"])
+}
+
+func maingenerator(r *http.Request, db *sql.DB) psfacade.Feed {
+	return psfacade.CalendarFeed(db)
+}
+
+func noschoolgenerator(r *http.Request, db *sql.DB) psfacade.Feed {
+	return psfacade.NoSchoolFeed(db)
+}
+
+func bellschedulegenerator(r *http.Request, db *sql.DB) psfacade.Feed {
+	return psfacade.BellScheduleFeed(db)
+}
+
+// dateParam returns the date given by the request parameter as YYYY-MM-DD,
+// or today if it is absent.
+func dateParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Now(), nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return date, fmt.Errorf("%s must be a date as YYYY-MM-DD", name)
+	}
+	return date, nil
+}
+
+func calendardayshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	writeJSONArray(w, psfacade.GetCalendarDays(db))
+}
+
+func noschoolhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	days := psfacade.GetSchoolCalendar(db).NoSchoolDays()
+	if days == nil {
+		days = []psfacade.CalDay{}
+	}
+	writeJSON(w, days)
+}
+
+// insessionhandler reports whether school is in session on the date
+// parameter (default today) and the next instructional day after it.
+func insessionhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	date, err := dateParam(r, "date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sc := psfacade.GetSchoolCalendar(db)
+	day, ok := sc.Day(date)
+	if !ok {
+		http.Error(w, "date is not in the school calendar", http.StatusNotFound)
+		return
+	}
+	result := struct {
+		psfacade.CalDay
+		NextInstructionalDay *time.Time `json:"next_instructional_day"`
+	}{CalDay: day}
+	if next, ok := sc.NextInstructionalDay(date); ok {
+		result.NextInstructionalDay = &next.Date
+	}
+	writeJSON(w, result)
+}
+
+// bellschedulehandler returns the bell schedule of the date parameter
+// (default today).
+func bellschedulehandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	date, err := dateParam(r, "date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sched, ok := psfacade.GetBellSchedule(db, date)
+	if !ok {
+		http.Error(w, "no bell schedule on that date", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, sched)
+}
+
+// cycledayhandler returns the cycle day of the date parameter (default today).
+func cycledayhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	date, err := dateParam(r, "date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	letter, ok := psfacade.GetSchoolCalendar(db).CycleDay(date)
+	if !ok {
+		http.Error(w, "no cycle day on that date", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]string{"date": date.Format("2006-01-02"), "cycle_day": letter})
+}
+
+// dateRange returns the dates from and up to but not including to given
+// by the term parameter as a term abbreviation of this year, or the month
+// parameter as YYYY-MM, or else by the from and to parameters, which
+// default to the whole school year.
+func dateRange(r *http.Request, db *sql.DB, sc *psfacade.SchoolCalendar) (from, to time.Time, err error) {
+	if abbreviation := r.URL.Query().Get("term"); abbreviation != "" {
+		term, ok := psfacade.FindTerm(psfacade.GetTerms(db, psfacade.CurrentYearID(db)), abbreviation)
+		if !ok {
+			return from, to, fmt.Errorf("no term %q this year", abbreviation)
+		}
+		return term.FirstDay, term.LastDay.AddDate(0, 0, 1), nil
+	}
+	if month := r.URL.Query().Get("month"); month != "" {
+		from, err = time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("month must be given as YYYY-MM")
+		}
+		return from, from.AddDate(0, 1, 0), nil
+	}
+	if len(sc.Days) > 0 {
+		from, to = sc.Days[0].Date, sc.Days[len(sc.Days)-1].Date.AddDate(0, 0, 1)
+	}
+	if r.URL.Query().Get("from") != "" {
+		if from, err = dateParam(r, "from"); err != nil {
+			return from, to, err
+		}
+	}
+	if r.URL.Query().Get("to") != "" {
+		if to, err = dateParam(r, "to"); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
+
+// cycledayshandler lists the days in session with the letter parameter's
+// cycle day (any if absent) in the range given by dateRange.
+func cycledayshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sc := psfacade.GetSchoolCalendar(db)
+	from, to, err := dateRange(r, db, sc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days := sc.CycleDays(r.URL.Query().Get("letter"), from, to)
+	if days == nil {
+		days = []psfacade.CalDay{}
+	}
+	writeJSON(w, days)
+}
+
+// cycledaycountshandler counts the days in session of each cycle day in
+// the range given by dateRange.
+func cycledaycountshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sc := psfacade.GetSchoolCalendar(db)
+	from, to, err := dateRange(r, db, sc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, sc.CycleDayCounts(from, to))
+}
+
+// termshandler returns the terms of the school year with the yearid
+// parameter, by default the current one.
+func termshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	yearid := psfacade.CurrentYearID(db)
+	if value := r.URL.Query().Get("yearid"); value != "" {
+		var err error
+		if yearid, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "yearid must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	terms := psfacade.GetTerms(db, yearid)
+	if terms == nil {
+		terms = []psfacade.Term{}
+	}
+	writeJSON(w, terms)
+}
+
+// knownroom wraps a handler of the room route variable so that a room
+// without sections this year gets a 404 naming the rooms most like it.
+func knownroom(next dbfunc) dbfunc {
+	return func(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+		room := mux.Vars(r)["room"]
+		rooms, err := psfacade.GetRoomNames(db)
+		if err != nil {
+			log.Printf("GetRoomNames: %v", err)
+			http.Error(w, "cannot read rooms", http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(rooms, room) {
+			msg := fmt.Sprintf("no sections in room %q this year", room)
+			if suggestions := psfacade.SuggestRooms(rooms, room, 5); len(suggestions) > 0 {
+				msg += "; did you mean " + strings.Join(suggestions, ", ") + "?"
+			}
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+		next(w, r, db)
+	}
+}
+
+func roomshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	writeJSONArray(w, psfacade.GetRooms(db))
+}
+
+func teachermeetingshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	writeJSONArray(w, psfacade.GetTeacherSched(db, mux.Vars(r)["loginid"]))
+}
+
+func roommeetingshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	writeJSONArray(w, psfacade.GetRoomSched(db, mux.Vars(r)["room"]))
+}
+
+// nowhandler reports the current and next meetings and the current period
+// for the kind of schedule named by the route variable, at the time
+// parameter (RFC 3339, default now).
+func nowhandler(kind, variable string) dbfunc {
+	return func(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+		t, err := nowTime(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		happening, _ := psfacade.GetHappening(db, kind, mux.Vars(r)[variable], t)
+		writeJSON(w, happening)
+	}
+}
+
+// nowTime returns the time given by the time parameter (RFC 3339), or now.
+func nowTime(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("time")
+	if value == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, errors.New("time must be in RFC 3339 form")
+	}
+	return t, nil
+}
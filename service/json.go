@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// writeJSONArray streams the items to w as a JSON array, encoding each item as it arrives.
+func writeJSONArray[T any](w http.ResponseWriter, items <-chan T) {
+	enc := json.NewEncoder(w)
+	streamJSONArray(w, items, func(item T) error { return enc.Encode(&item) })
+}
+
+// streamJSONArray writes the items to w as a JSON array, using encode to
+// write each item as it arrives.
+func streamJSONArray[T any](w http.ResponseWriter, items <-chan T, encode func(T) error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintln(w, "[")
+
+	first := true
+	for item := range items {
+		if !first {
+			fmt.Fprintf(w, ",")
+		}
+
+		if err := encode(item); err != nil {
+			log.Println(err)
+			for range items {
+				// drain so that the producing goroutine can finish
+			}
+			return
+		}
+		first = false
+	}
+
+	fmt.Fprintln(w, "]")
+}
+
+// writeJSON writes v to w as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
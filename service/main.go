@@ -1,99 +1,185 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/fredcy/psfacade"
+	"github.com/fredcy/psfacade/caldav"
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-oci8"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
 	"time"
 )
 
-type dbfunc func(http.ResponseWriter, *http.Request, *sql.DB)
+// Config is the server configuration file format. File names are optional.
+type Config struct {
+	Address         string // listen and serve at this address
+	PSConfig        string // PowerSchool connection file (see psfacade.GetConfig); if empty, PS_DSN is used
+	Rules           string // calendar rules file
+	Policy          string // student privacy policy file
+	Auth            string // authentication config file
+	MaxAge          int    // Cache-Control max-age value for calendars
+	ShutdownTimeout int    // seconds to let in-flight responses finish at shutdown
+}
 
-func wrapdb(fn dbfunc, db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		fn(w, r, db)
-	}
+var config = Config{
+	Address:         ":8080",
+	MaxAge:          8 * 3600,
+	ShutdownTimeout: 60,
 }
 
-func wraptimer(fn http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		starttime := time.Now()
-		fn(w, r)
-		endtime := time.Now()
-		log.Printf("Served %v in %v", r.URL, endtime.Sub(starttime))
+var configfile = flag.String("config", "", "JSON file of server configuration (optional)")
+var address = flag.String("address", "", "Listen and serve at this address (overrides config)")
+var logflags = flag.Int("logflags", 3, "Flags to standard logger")
+var signpath = flag.String("sign", "", "Print the signed URL path for this calendar path (e.g. /pscal/u/fogel) and exit")
+
+func readConfig(filename string) {
+	conffile, err := os.Open(filename)
+	if err != nil {
+		log.Panicf("cannot open config file (%v)", filename)
+	}
+	defer conffile.Close()
+	log.Printf("Reading %s for server config", filename)
+	decoder := json.NewDecoder(conffile)
+	jerr := decoder.Decode(&config)
+	if jerr != nil {
+		log.Panicf("Cannot decode json file %v: %v", filename, jerr)
 	}
 }
 
-func studentshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	students := psfacade.GetStudents(db)
+var dsnre = regexp.MustCompile(`^(.*?)/(.*?)@(.*?):(.*)`)
+
+// getDSN returns the DSN for accessing the PowerSchool database.
+func getDSN() string {
+	if config.PSConfig != "" {
+		return psfacade.MakeDSN(psfacade.GetConfig(config.PSConfig))
+	}
+	dsn := os.Getenv("PS_DSN")
+	match := dsnre.FindStringSubmatch(dsn)
+	if match == nil {
+		log.Panic("PS_DSN value is not well formed:", dsn)
+	}
+	log.Printf("PowerSchool host is %s", match[3])
+	return dsn
+}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	fmt.Fprintln(w, "[")
-	enc := json.NewEncoder(w)
+// signURL prints the signed form of the path, using the configured URL signing key.
+func signURL(path string) {
+	if config.Auth == "" {
+		log.Fatal("-sign requires an Auth file in the config")
+	}
+	signer, ok := psfacade.GetAuth(config.Auth).Signer()
+	if !ok {
+		log.Fatalf("%s has no URLSigningKey", config.Auth)
+	}
+	fmt.Println(signer.Sign(path))
+}
 
-	first := true
-	for s := range students {
-		if !first {
-			fmt.Fprintf(w, ",")
-		}
+// caldavPrefix is where the CalDAV service is mounted.
+const caldavPrefix = "/caldav/"
 
-		if err := enc.Encode(&s); err != nil {
-			log.Println(err)
-			return
-		}
-		first = false
+// newRouter returns the router for all of the services.
+func newRouter(db *sql.DB) *mux.Router {
+	r := mux.NewRouter()
+	route := func(path string, fn dbfunc) {
+		r.Handle(path, wrapdb(fn, db)).Methods("GET", "HEAD")
 	}
 
-	fmt.Fprintln(w, "]")
+	route("/students", studentshandler)
+	route("/students/{number}", studenthandler)
+	route("/students/{number}/now", visiblefield("room", studentnowhandler))
+	route("/calendar/days", calendardayshandler)
+	route("/calendar/terms", termshandler)
+	route("/calendar/noschool", noschoolhandler)
+	route("/calendar/insession", insessionhandler)
+	route("/calendar/bellschedule", bellschedulehandler)
+	route("/calendar/cycleday", cycledayhandler)
+	route("/calendar/cycledays", cycledayshandler)
+	route("/calendar/cycledays/counts", cycledaycountshandler)
+	route("/teachers", teachershandler)
+	route("/teachers/{loginid}/meetings", teachermeetingshandler)
+	route("/rooms", roomshandler)
+	route("/reports/rooms", roomutilizationhandler)
+	route("/reports/workload", workloadhandler)
+	route("/rooms/{room}/meetings", knownroom(roommeetingshandler))
+	route("/teachers/{loginid}/now", nowhandler("teacher", "loginid"))
+	route("/rooms/{room}/now", knownroom(nowhandler("room", "room")))
+
+	route("/pscal/u/{loginid}", calhandler(usergenerator))
+	route("/pscal/r/{room:.+}", knownroom(calhandler(roomgenerator)))
+	route("/pscal/cal", calhandler(maingenerator))
+	route("/pscal/noschool", calhandler(noschoolgenerator))
+	route("/pscal/picker", pickerhandler)
+	route("/pscal/bellschedule", calhandler(bellschedulegenerator))
+
+	r.PathPrefix(caldavPrefix).Handler(caldav.NewHandler(caldavPrefix, caldav.DBBackend{DB: db}))
+	r.Handle("/.well-known/caldav", http.RedirectHandler(caldavPrefix, http.StatusMovedPermanently))
+	return r
 }
 
-var address = flag.String("address", ":8080", "Listen and serve at this address")
-
 func main() {
 	flag.Parse()
-
-	dsn := os.Getenv("PS_DSN")
-	if dsn == "" {
-		log.Panic("PS_DSN not set")
+	log.SetFlags(*logflags)
+	if *configfile != "" {
+		readConfig(*configfile)
+	}
+	if *address != "" {
+		config.Address = *address
+	}
+	if *signpath != "" {
+		signURL(*signpath)
+		return
+	}
+	if config.Rules != "" {
+		psfacade.SetRules(psfacade.GetRules(config.Rules))
+	}
+	if config.Policy != "" {
+		policy = psfacade.GetStudentPolicy(config.Policy)
 	}
 
-	db, err := sql.Open("oci8", dsn)
+	db, err := sql.Open("oci8", getDSN())
 	if err != nil {
 		log.Panic(err)
 	}
+	defer db.Close()
 
-	r := mux.NewRouter()
-	r.HandleFunc("/students", wraptimer(wrapdb(studentshandler, db)))
-	http.Handle("/", &MyServer{r})
-
-	log.Printf("Listening at %s", *address)
-	log.Fatal(http.ListenAndServe(*address, nil))
-}
-
-/* See http://stackoverflow.com/questions/12830095/setting-http-headers-in-golang about CORS */
-
-type MyServer struct {
-	r *mux.Router
-}
-
-func (s *MyServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if origin := req.Header.Get("Origin"); origin != "" {
-		rw.Header().Set("Access-Control-Allow-Origin", origin)
-		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		rw.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	server := &MyServer{r: newRouter(db)}
+	if config.Auth != "" {
+		server.auth = psfacade.GetAuth(config.Auth)
+		if s, ok := server.auth.Signer(); ok {
+			signer = &s
+		}
 	}
-	// Stop here if its Preflighted OPTIONS request
-	if req.Method == "OPTIONS" {
-		return
+	srv := &http.Server{Addr: config.Address, Handler: wraptimer(server)}
+
+	// On SIGTERM or SIGINT stop accepting requests and let the ones in
+	// progress, including streaming responses, finish.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		<-ctx.Done()
+		stop()
+		log.Printf("Shutting down, waiting up to %ds for requests in progress", config.ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout)*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("Listening at %s", config.Address)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
-	// Lets Gorilla work
-	s.r.ServeHTTP(rw, req)
+	<-done
+	log.Print("Stopped")
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/fredcy/psfacade"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type dbfunc func(http.ResponseWriter, *http.Request, *sql.DB)
+
+func wrapdb(fn dbfunc, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r, db)
+	}
+}
+
+// statusWriter records the status and size of a response. It passes Flush
+// through so that streaming handlers still stream.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += n
+	return n, err
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wraptimer logs each request with its client, status, size and time taken.
+func wraptimer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		starttime := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		client := r.RemoteAddr
+		forwarded_for := strings.Join(r.Header["X-Forwarded-For"], "")
+		if forwarded_for != "" {
+			client += " (" + forwarded_for + ")"
+		}
+		endtime := time.Now()
+		log.Printf("Served %v %v to %v: %d, %d bytes in %v",
+			r.Method, r.URL, client, sw.status, sw.size, endtime.Sub(starttime))
+	})
+}
+
+/* See http://stackoverflow.com/questions/12830095/setting-http-headers-in-golang about CORS */
+
+// MyServer handles CORS and authorization before passing requests to the router.
+type MyServer struct {
+	r    http.Handler
+	auth *psfacade.Auth // if nil, all requests and origins are allowed
+}
+
+func (s *MyServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin != "" && (s.auth == nil || s.auth.AllowedOrigin(origin)) {
+		rw.Header().Set("Access-Control-Allow-Origin", origin)
+		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PROPFIND, REPORT")
+		rw.Header().Set("Access-Control-Allow-Headers",
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	}
+	// Stop here if its Preflighted OPTIONS request, except that CalDAV
+	// clients use OPTIONS to discover the service
+	if req.Method == "OPTIONS" {
+		if strings.HasPrefix(req.URL.Path, caldavPrefix) {
+			s.r.ServeHTTP(rw, req)
+		}
+		return
+	}
+	// Lets Gorilla work
+	if s.auth != nil {
+		s.auth.Handler(s.r).ServeHTTP(rw, req)
+		return
+	}
+	s.r.ServeHTTP(rw, req)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/fredcy/psfacade"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// signer signs the subscription URLs made by the picker, if the auth
+// configuration has a URL signing key.
+var signer *psfacade.URLSigner
+
+// teachershandler lists the active teachers matching the q parameter by
+// name or loginid prefix, and inactive ones too if inactive=1.
+func teachershandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	q := r.URL.Query()
+	teachers := psfacade.FindTeachers(db, q.Get("q"), q.Get("inactive") == "1")
+	if teachers == nil {
+		teachers = []psfacade.Teacher{}
+	}
+	writeJSON(w, teachers)
+}
+
+// subscriptionURL returns the absolute URL of the calendar path, signed if
+// there is a signer so that calendar clients need not authenticate.
+func subscriptionURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: path}
+	if signer != nil {
+		u.RawQuery = strings.TrimPrefix(signer.Sign(path), path+"?")
+	}
+	return u.String()
+}
+
+type pickerChoice struct {
+	Name, Detail, URL string
+}
+
+var pickerTemplate = template.Must(template.New("picker").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>IMSA PowerSchool calendar subscriptions</title></head>
+<body>
+<h1>IMSA PowerSchool calendar subscriptions</h1>
+<form method="get">
+<label>Teacher name or loginid <input name="q" value="{{.Query}}" autofocus></label>
+<label>or room <input name="room" value="{{.Room}}"></label>
+<button type="submit">Find</button>
+</form>
+{{if .Choices}}<p>Copy the URL of a calendar into your calendar program's "subscribe" or "add from URL" dialog.</p>
+<table>
+<tr><th>Calendar</th><th></th><th>Subscription URL</th></tr>
+{{range .Choices}}<tr><td>{{.Name}}</td><td>{{.Detail}}</td><td><a href="{{.URL}}">{{.URL}}</a></td></tr>
+{{end}}</table>
+{{else if or .Query .Room}}<p>No calendars found.</p>
+{{end}}</body>
+</html>
+`))
+
+// pickerhandler serves a page for finding a teacher or room and getting
+// the subscription URL of its calendar.
+func pickerhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	data := struct {
+		Query, Room string
+		Choices     []pickerChoice
+	}{Query: strings.TrimSpace(r.URL.Query().Get("q")), Room: strings.TrimSpace(r.URL.Query().Get("room"))}
+	if data.Query != "" {
+		for _, t := range psfacade.FindTeachers(db, data.Query, false) {
+			data.Choices = append(data.Choices, pickerChoice{
+				Name:   t.Name(),
+				Detail: t.Department,
+				URL:    subscriptionURL(r, "/pscal/u/"+t.LoginID),
+			})
+		}
+	}
+	if data.Room != "" {
+		rooms, err := psfacade.GetRoomNames(db)
+		if err != nil {
+			log.Printf("GetRoomNames: %v", err)
+		}
+		detail := ""
+		if !slices.Contains(rooms, data.Room) {
+			rooms, detail = psfacade.SuggestRooms(rooms, data.Room, 5), "did you mean this room?"
+		} else {
+			rooms = []string{data.Room}
+		}
+		for _, room := range rooms {
+			data.Choices = append(data.Choices, pickerChoice{
+				Name:   "Room " + room,
+				Detail: detail,
+				URL:    subscriptionURL(r, "/pscal/r/"+room),
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pickerTemplate.Execute(w, data); err != nil {
+		log.Printf("picker: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/fredcy/psfacade"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// roomutilizationhandler reports the use of the rooms during the term
+// parameter's term as JSON, CSV or, with format=matrix, a heat map matrix.
+func roomutilizationhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	switch format {
+	case "", "json", "csv", "matrix":
+	default:
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+		return
+	}
+	if q.Get("term") == "" {
+		http.Error(w, "term is required, e.g. term=S1", http.StatusBadRequest)
+		return
+	}
+	report, ok := psfacade.GetRoomUtilization(db, q.Get("term"))
+	if !ok {
+		http.Error(w, "no such term this year", http.StatusNotFound)
+		return
+	}
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := psfacade.WriteUtilizationCSV(w, report); err != nil {
+			log.Println(err)
+		}
+	case "matrix":
+		writeJSON(w, report.Matrix())
+	default:
+		writeJSON(w, report)
+	}
+}
+
+// workloadhandler reports the teaching loads of the teachers during the
+// term parameter's term as JSON or CSV, limited to the department
+// parameter's department if given.
+func workloadhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	switch format {
+	case "", "json", "csv":
+	default:
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+		return
+	}
+	if q.Get("term") == "" {
+		http.Error(w, "term is required, e.g. term=S1", http.StatusBadRequest)
+		return
+	}
+	workloads, ok := psfacade.GetTeacherWorkload(db, q.Get("term"))
+	if !ok {
+		http.Error(w, "no such term this year", http.StatusNotFound)
+		return
+	}
+	if department := q.Get("department"); department != "" {
+		var kept []psfacade.Workload
+		for _, wl := range workloads {
+			if strings.EqualFold(wl.Department, department) {
+				kept = append(kept, wl)
+			}
+		}
+		workloads = kept
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := psfacade.WriteWorkloadCSV(w, workloads); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if workloads == nil {
+		workloads = []psfacade.Workload{}
+	}
+	writeJSON(w, workloads)
+}
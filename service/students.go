@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/fredcy/psfacade"
+	"github.com/gorilla/mux"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const maxStudentLimit = 1000
+
+var policy = psfacade.DefaultStudentPolicy()
+
+// clientAddr returns the address of the client without the port.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// studentFilterFields are the student fields that the filter parameters
+// reveal. Which students include_inactive adds reveals their enrollment.
+var studentFilterFields = map[string]string{
+	"username":         "username",
+	"room":             "room",
+	"grade":            "grade_level",
+	"include_inactive": "enroll_status",
+}
+
+// hiddenParam returns a parameter given in params whose field in fields the
+// role cannot see, since filtering on a field would reveal it, or false if
+// there is none.
+func hiddenParam(role string, params url.Values, fields map[string]string) (string, bool) {
+	for param, field := range fields {
+		if params.Get(param) != "" && !policy.Visible(role, field) {
+			return param, true
+		}
+	}
+	return "", false
+}
+
+// studentRequest holds the student query parameters common to
+// studentshandler and studenthandler.
+type studentRequest struct {
+	filter    psfacade.StudentFilter
+	role      string
+	requested []string // optional fields asked for
+	format    string   // "json", "csv" or "xlsx"
+	columns   []string // columns for csv and xlsx
+}
+
+// studentFormat returns the output format chosen by the format parameter or
+// else by the Accept header.
+func studentFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case "json", "csv", "xlsx":
+			return format, nil
+		}
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return "csv", nil
+	case strings.Contains(accept, psfacade.XLSXContentType):
+		return "xlsx", nil
+	}
+	return "json", nil
+}
+
+// parseStudentRequest returns the filter for the student query parameters,
+// or an error describing a bad parameter. The filter asks only for the
+// requested fields visible to the client's role. For csv and xlsx output the
+// columns parameter gives the columns in order, and its optional fields are
+// the requested ones.
+func parseStudentRequest(r *http.Request) (studentRequest, error) {
+	params := r.URL.Query()
+	sr := studentRequest{role: policy.RoleFor(psfacade.PrincipalFrom(r.Context()))}
+	var err error
+	if sr.format, err = studentFormat(r); err != nil {
+		return sr, err
+	}
+	if fields := params.Get("fields"); fields != "" {
+		sr.requested = strings.Split(fields, ",")
+	}
+	if err := psfacade.CheckStudentFields(sr.requested, true); err != nil {
+		return sr, err
+	}
+	sr.columns = psfacade.StudentColumns(sr.requested)
+	if columns := params.Get("columns"); columns != "" && sr.format != "json" {
+		sr.columns = strings.Split(columns, ",")
+		if sr.requested, err = psfacade.CheckStudentColumns(sr.columns); err != nil {
+			return sr, err
+		}
+	}
+	sr.filter = psfacade.StudentFilter{
+		Fields:          policy.VisibleFields(sr.role, sr.requested),
+		AllowSensitive:  true, // the policy has already screened the fields
+		IncludeInactive: params.Get("include_inactive") != "",
+	}
+	return sr, nil
+}
+
+// writeStudents streams the students in the requested format, applying the privacy policy.
+func writeStudents(w http.ResponseWriter, r *http.Request, sr studentRequest, students <-chan psfacade.Student) {
+	enc := policy.NewEncoder(w, sr.role, clientAddr(r), sr.requested)
+	defer enc.Close()
+	var err error
+	switch sr.format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="students.csv"`)
+		err = psfacade.WriteStudentsCSV(w, enc.Redact(students), sr.columns)
+	case "xlsx":
+		w.Header().Set("Content-Type", psfacade.XLSXContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="students.xlsx"`)
+		err = psfacade.WriteStudentsXLSX(w, enc.Redact(students), sr.columns)
+	default:
+		streamJSONArray(w, students, enc.Encode)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// studentshandler serves the student list, optionally filtered by the
+// username, room and grade parameters. The fields parameter is a
+// comma-separated list of optional fields to include. The list is JSON
+// unless the format parameter or Accept header asks for csv or xlsx. Given a limit parameter it serves one
+// page of students and sets X-Next-Cursor (and a Link header) to the value of
+// the after parameter that fetches the next page.
+func studentshandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sr, err := parseStudentRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := &sr.filter
+	params := r.URL.Query()
+	if param, ok := hiddenParam(sr.role, params, studentFilterFields); ok {
+		http.Error(w, fmt.Sprintf("filtering by %s is not authorized", param), http.StatusForbidden)
+		return
+	}
+	// The cursor encodes the name and number, and where a page starts
+	// reveals them too, so only roles that can see them may page.
+	if params.Get("after") != "" || params.Get("limit") != "" {
+		for _, field := range []string{"number", "first_name", "last_name"} {
+			if !policy.Visible(sr.role, field) {
+				http.Error(w, "paging is not authorized", http.StatusForbidden)
+				return
+			}
+		}
+	}
+	filter.Username = params.Get("username")
+	filter.Room = params.Get("room")
+	if grade := params.Get("grade"); grade != "" {
+		g, err := strconv.Atoi(grade)
+		if err != nil {
+			http.Error(w, "invalid grade", http.StatusBadRequest)
+			return
+		}
+		filter.Grade = g
+	}
+	if after := params.Get("after"); after != "" {
+		cursor, err := psfacade.ParseStudentCursor(after)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.After = &cursor
+	}
+	limit := params.Get("limit")
+	if limit == "" {
+		writeStudents(w, r, sr, psfacade.FindStudents(db, *filter))
+		return
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxStudentLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxStudentLimit), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch one extra student to learn whether there is a next page. The
+	// page is bounded by the limit, so collect it in order to set the
+	// headers before writing the body.
+	filter.Limit = n + 1
+	var page []psfacade.Student
+	for s := range psfacade.FindStudents(db, *filter) {
+		page = append(page, s)
+	}
+	if len(page) > n {
+		page = page[:n]
+		next := page[n-1].Cursor().String()
+		nextURL := *r.URL
+		params.Set("after", next)
+		nextURL.RawQuery = params.Encode()
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+	}
+	items := make(chan psfacade.Student, len(page))
+	for _, s := range page {
+		items <- s
+	}
+	close(items)
+	writeStudents(w, r, sr, items)
+}
+
+// studenthandler serves the single student with the given student number.
+func studenthandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sr, err := parseStudentRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if param, ok := hiddenParam(sr.role, r.URL.Query(), map[string]string{"include_inactive": "enroll_status"}); ok {
+		http.Error(w, fmt.Sprintf("%s is not authorized", param), http.StatusForbidden)
+		return
+	}
+	sr.filter.Number = mux.Vars(r)["number"]
+	sr.filter.Limit = 1
+	s, ok := <-psfacade.FindStudents(db, sr.filter)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := policy.NewEncoder(w, sr.role, clientAddr(r), sr.requested)
+	defer enc.Close()
+	if err := enc.Encode(s); err != nil {
+		log.Println(err)
+	}
+}
+
+// visiblefield wraps a handler that reveals the student field, as where a
+// student is now reveals the room, so that only roles that can see the
+// field may use it.
+func visiblefield(field string, next dbfunc) dbfunc {
+	return func(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+		role := policy.RoleFor(psfacade.PrincipalFrom(r.Context()))
+		if !policy.Visible(role, field) {
+			http.Error(w, fmt.Sprintf("%s of students is not authorized", field), http.StatusForbidden)
+			return
+		}
+		next(w, r, db)
+	}
+}
+
+// studentnowhandler reports the current and next meetings of the student
+// with the given number as nowhandler does, but only where and when they are
+// for roles that cannot see the student's schedule.
+func studentnowhandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	t, err := nowTime(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	happening, _ := psfacade.GetHappening(db, "student", mux.Vars(r)["number"], t)
+	if !policy.Visible(policy.RoleFor(psfacade.PrincipalFrom(r.Context())), "schedule") {
+		happening = happening.WithoutCourses()
+	}
+	writeJSON(w, happening)
+}
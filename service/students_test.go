@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/fredcy/psfacade"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestStudentsRefused checks the requests that studentshandler refuses for
+// fields the role cannot see, before it queries the database.
+func TestStudentsRefused(t *testing.T) {
+	saved := policy
+	defer func() { policy = saved }()
+	policy = psfacade.StudentPolicy{
+		DefaultRole: "lookup",
+		Roles: map[string]psfacade.RolePolicy{
+			"lookup":  {Fields: []string{"grade_level"}, Redact: []string{"room"}},
+			"reslife": {Fields: []string{"number", "first_name", "last_name", "room"}},
+		},
+	}
+	auth := &psfacade.Auth{
+		Authenticators: []psfacade.Authenticator{psfacade.APIKeys{"housing": {Key: "k", Roles: []string{"reslife"}}}},
+		Routes:         []psfacade.RouteRule{{Prefix: "/", Roles: []string{psfacade.AnonymousRole}}},
+	}
+	handler := auth.Handler(wrapdb(studentshandler, nil))
+	cursor := psfacade.StudentCursor{LastName: "M", FirstName: "A", Number: "1"}.String()
+
+	tests := []struct {
+		name, target, key string
+	}{
+		{"cursor without limit", "/students?after=" + cursor, ""},
+		{"limit", "/students?limit=10", ""},
+		{"room filter", "/students?room=A113", ""},
+		{"username filter", "/students?username=jdoe", ""},
+		{"grade filter of a role with a key", "/students?grade=11", "k"},
+		{"inactive students", "/students?include_inactive=1", "k"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.target, nil)
+		r.RemoteAddr = "127.0.0.1:4000" // an address once given its own role
+		if test.key != "" {
+			r.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, body %q", test.name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -2,36 +2,247 @@ package psfacade
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 )
 
-// Student is the student data obtained from PowerSchool
+// Student is the student data obtained from PowerSchool. The fields after
+// Username are filled in only when requested in StudentFilter.Fields. Empty
+// fields are left out of the JSON so that a StudentPolicy can omit any field.
 type Student struct {
-	Number    string
-	FirstName string
+	Number       string `json:",omitempty"`
+	FirstName    string `json:",omitempty"`
+	LastName     string `json:",omitempty"`
+	Room         string `json:",omitempty"`
+	Username     string `json:",omitempty"`
+	GradeLevel   string `json:",omitempty"`
+	Email        string `json:",omitempty"`
+	DOB          string `json:",omitempty"`
+	HomeRoom     string `json:",omitempty"`
+	Advisor      string `json:",omitempty"`
+	EntryDate    string `json:",omitempty"`
+	ExitDate     string `json:",omitempty"`
+	EnrollStatus string `json:",omitempty"`
+}
+
+// studentField describes an optional Student field and how to query it.
+type studentField struct {
+	name      string
+	column    string
+	sensitive bool
+	dest      func(*Student) *string
+}
+
+var studentFields = []studentField{
+	{"grade_level", "to_char(grade_level)", false, func(s *Student) *string { return &s.GradeLevel }},
+	{"email", "student_web_id || '@imsa.edu'", false, func(s *Student) *string { return &s.Email }},
+	{"dob", "to_char(dob, 'YYYY-MM-DD')", true, func(s *Student) *string { return &s.DOB }},
+	{"home_room", "home_room", false, func(s *Student) *string { return &s.HomeRoom }},
+	{"advisor", "ps_customfields.getStudentscf(id, 'IMSA_Advisor')", false, func(s *Student) *string { return &s.Advisor }},
+	{"entry_date", "to_char(entrydate, 'YYYY-MM-DD')", false, func(s *Student) *string { return &s.EntryDate }},
+	{"exit_date", "to_char(exitdate, 'YYYY-MM-DD')", true, func(s *Student) *string { return &s.ExitDate }},
+	{"enroll_status", "to_char(enroll_status)", true, func(s *Student) *string { return &s.EnrollStatus }},
+}
+
+// StudentFieldNames returns the names of the optional Student fields.
+func StudentFieldNames() []string {
+	var names []string
+	for _, f := range studentFields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// IsSensitiveStudentField reports whether the named optional field is privacy-sensitive.
+func IsSensitiveStudentField(name string) bool {
+	f, ok := lookupStudentField(name)
+	return ok && f.sensitive
+}
+
+func lookupStudentField(name string) (studentField, bool) {
+	for _, f := range studentFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return studentField{}, false
+}
+
+// CheckStudentFields returns an error if any of the named fields is unknown,
+// or is sensitive when allowSensitive is false.
+func CheckStudentFields(names []string, allowSensitive bool) error {
+	for _, name := range names {
+		f, ok := lookupStudentField(name)
+		if !ok {
+			return fmt.Errorf("unknown student field %q", name)
+		}
+		if f.sensitive && !allowSensitive {
+			return fmt.Errorf("student field %q is not authorized", name)
+		}
+	}
+	return nil
+}
+
+// StudentColumns returns the default columns for tabular student output:
+// the basic fields followed by the given optional fields.
+func StudentColumns(fields []string) []string {
+	return append(append([]string{}, basicStudentFields...), fields...)
+}
+
+// CheckStudentColumns returns an error if any of the columns is not a
+// Student field name, and otherwise the optional fields among the columns.
+func CheckStudentColumns(columns []string) ([]string, error) {
+	var fields []string
+	for _, name := range columns {
+		if contains(basicStudentFields, name) {
+			continue
+		}
+		if _, ok := lookupStudentField(name); !ok {
+			return nil, fmt.Errorf("unknown student column %q", name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// StudentFilter selects the students returned by FindStudents. Zero-valued
+// fields do not restrict the results.
+type StudentFilter struct {
+	Number   string         // exact student number
+	Username string         // exact username (student_web_id)
+	Room     string         // room prefix, so that a dorm prefix matches all its rooms
+	Grade    int            // grade level
+	After    *StudentCursor // return only students sorting after this position
+	Limit    int            // maximum number of students to return
+
+	Fields          []string // optional fields to fill in (see StudentFieldNames)
+	AllowSensitive  bool     // the caller is authorized for sensitive fields
+	IncludeInactive bool     // include students not currently enrolled
+}
+
+// StudentCursor is a position in the student ordering (last name, first
+// name, student number) used to page through the student list.
+type StudentCursor struct {
 	LastName  string
-	Room      string
-	Username  string
+	FirstName string
+	Number    string
+}
+
+// Cursor returns the position of the student in the student ordering.
+func (s Student) Cursor() StudentCursor {
+	return StudentCursor{s.LastName, s.FirstName, s.Number}
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c StudentCursor) String() string {
+	b, _ := json.Marshal([]string{c.LastName, c.FirstName, c.Number})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseStudentCursor decodes a token produced by StudentCursor.String.
+func ParseStudentCursor(token string) (StudentCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return StudentCursor{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+	var fields []string
+	if err := json.Unmarshal(b, &fields); err != nil || len(fields) != 3 {
+		return StudentCursor{}, fmt.Errorf("invalid cursor %q", token)
+	}
+	return StudentCursor{fields[0], fields[1], fields[2]}, nil
 }
 
 var studentQuery = `
 select to_char(student_number) "student_number",
 first_name, last_name,
 ps_customfields.getStudentscf(id, 'IMSA_Student_Room') room,
---to_char(dob, 'YYYY-MM-DD') dob,
-student_web_id username
-from students where schoolid = 140177
-and enroll_status = 0
-order by last_name, first_name
+student_web_id username%s
+from students where schoolid = 140177%s
+order by last_name, first_name, student_number
 `
 
+// fields returns the requested optional fields, each once, leaving out
+// sensitive ones unless they are allowed.
+func (f StudentFilter) fields() []studentField {
+	var fields []studentField
+	seen := map[string]bool{}
+	for _, name := range f.Fields {
+		field, ok := lookupStudentField(name)
+		if !ok || (field.sensitive && !f.AllowSensitive) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// likeEscaper escapes the LIKE wildcards of a pattern for escape '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// query returns the student query with the filter conditions applied, along
+// with the values for its bind variables.
+func (f StudentFilter) query() (string, []interface{}) {
+	var columns string
+	for _, field := range f.fields() {
+		columns += ",\n" + field.column + " " + field.name
+	}
+
+	var conds []string
+	var args []interface{}
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf(":%d", len(args))
+	}
+	if !f.IncludeInactive {
+		conds = append(conds, "enroll_status = 0")
+	}
+	if f.Number != "" {
+		conds = append(conds, "student_number = "+bind(f.Number))
+	}
+	if f.Username != "" {
+		conds = append(conds, "student_web_id = "+bind(f.Username))
+	}
+	if f.Room != "" {
+		conds = append(conds, "ps_customfields.getStudentscf(id, 'IMSA_Student_Room') like "+bind(likeEscaper.Replace(f.Room))+` || '%' escape '\'`)
+	}
+	if f.Grade != 0 {
+		conds = append(conds, "grade_level = "+bind(f.Grade))
+	}
+	if f.After != nil {
+		conds = append(conds, fmt.Sprintf("(last_name > %s or (last_name = %s and (first_name > %s or (first_name = %s and student_number > %s))))",
+			bind(f.After.LastName), bind(f.After.LastName),
+			bind(f.After.FirstName), bind(f.After.FirstName), bind(f.After.Number)))
+	}
+
+	var where string
+	for _, cond := range conds {
+		where += "\nand " + cond
+	}
+	query := fmt.Sprintf(studentQuery, columns, where)
+	if f.Limit > 0 {
+		query = fmt.Sprintf("select * from (%s) where rownum <= %s", query, bind(f.Limit))
+	}
+	return query, args
+}
+
 // GetStudents reads the PowerSchool database and returns a channel of Student values
 func GetStudents(db *sql.DB) <-chan Student {
+	return FindStudents(db, StudentFilter{})
+}
+
+// FindStudents returns a channel of the Student values matching the filter
+func FindStudents(db *sql.DB, filter StudentFilter) <-chan Student {
 	students := make(chan Student)
-	rows, err := db.Query(studentQuery)
+	fields := filter.fields()
+	query, args := filter.query()
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Printf("ERROR: query failed: %v", err)
-		log.Printf("query=\"%v\"", studentQuery)
+		log.Printf("query=\"%v\" args=%v", strings.TrimSpace(query), args)
 		close(students)
 		return students
 	}
@@ -40,12 +251,20 @@ func GetStudents(db *sql.DB) <-chan Student {
 		defer rows.Close()
 		for rows.Next() {
 			student := Student{}
-			err := rows.Scan(&student.Number, &student.FirstName, &student.LastName, &student.Room,
-				&student.Username)
+			dests := []interface{}{&student.Number, &student.FirstName, &student.LastName, &student.Room,
+				&student.Username}
+			values := make([]sql.NullString, len(fields))
+			for i := range values {
+				dests = append(dests, &values[i])
+			}
+			err := rows.Scan(dests...)
 			if err != nil {
 				log.Printf("rows.Scan: %v", err)
 				return
 			}
+			for i, field := range fields {
+				*field.dest(&student) = emptyifnull(values[i])
+			}
 			students <- student
 		}
 		err := rows.Err()
@@ -0,0 +1,167 @@
+package psfacade
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStudentCursor(t *testing.T) {
+	s := Student{Number: "12345", FirstName: "Ann", LastName: "O'Neil, Jr."}
+	token := s.Cursor().String()
+	c, err := ParseStudentCursor(token)
+	if err != nil {
+		t.Fatalf("ParseStudentCursor(%q): %v", token, err)
+	}
+	if c != s.Cursor() {
+		t.Errorf("cursor round trip: expected %v, got %v", s.Cursor(), c)
+	}
+	if _, err := ParseStudentCursor("not a cursor"); err == nil {
+		t.Errorf("ParseStudentCursor accepted an invalid token")
+	}
+}
+
+func TestStudentFilterQuery(t *testing.T) {
+	query, args := StudentFilter{}.query()
+	if len(args) != 0 || strings.Contains(query, ":1") {
+		t.Errorf("empty filter has bind variables: %v", args)
+	}
+
+	after := StudentCursor{"Smith", "Jo", "123"}
+	query, args = StudentFilter{Room: "05", Grade: 11, After: &after, Limit: 10}.query()
+	if len(args) != 8 {
+		t.Fatalf("expected 8 args, got %v", args)
+	}
+	for i := 1; i <= len(args); i++ {
+		if !strings.Contains(query, fmt.Sprintf(":%d", i)) {
+			t.Errorf("query lacks bind variable :%d", i)
+		}
+	}
+	if args[len(args)-1] != 10 {
+		t.Errorf("last arg should be the limit, got %v", args[len(args)-1])
+	}
+
+	_, args = StudentFilter{Room: `5_%\`}.query()
+	if len(args) != 1 || args[0] != `5\_\%\\` {
+		t.Errorf("room prefix wildcards not escaped: %v", args)
+	}
+
+	// a field asked for twice would be a duplicate column under the limit
+	query, _ = StudentFilter{Fields: []string{"grade_level", "grade_level"}, Limit: 10}.query()
+	if n := strings.Count(query, "to_char(grade_level) grade_level"); n != 1 {
+		t.Errorf("grade_level selected %d times:\n%s", n, query)
+	}
+}
+
+func TestStudentFields(t *testing.T) {
+	if err := CheckStudentFields([]string{"grade_level", "email"}, false); err != nil {
+		t.Errorf("CheckStudentFields: %v", err)
+	}
+	if err := CheckStudentFields([]string{"dob"}, false); err == nil {
+		t.Errorf("CheckStudentFields allowed dob without authorization")
+	}
+	if err := CheckStudentFields([]string{"shoe_size"}, true); err == nil {
+		t.Errorf("CheckStudentFields allowed an unknown field")
+	}
+
+	query, _ := StudentFilter{Fields: []string{"grade_level", "dob"}}.query()
+	if !strings.Contains(query, "grade_level") || strings.Contains(query, "dob") {
+		t.Errorf("unauthorized query should select grade_level but not dob: %v", query)
+	}
+	query, _ = StudentFilter{Fields: []string{"dob"}, AllowSensitive: true}.query()
+	if !strings.Contains(query, "dob") {
+		t.Errorf("authorized query should select dob: %v", query)
+	}
+}
+
+func TestStudentPolicy(t *testing.T) {
+	policy := StudentPolicy{
+		DefaultRole: "public",
+		Roles: map[string]RolePolicy{
+			"public":    {Fields: []string{"number", "last_name"}, Redact: []string{"room", "dob"}},
+			"registrar": {Fields: []string{"*"}},
+		},
+	}
+	if role := policy.RoleFor(nil); role != "public" {
+		t.Errorf("anonymous client has role %v", role)
+	}
+	if role := policy.RoleFor(&Principal{Name: "caldav", Roles: []string{"calendar"}}); role != "public" {
+		t.Errorf("principal without a student role has role %v", role)
+	}
+	if role := policy.RoleFor(&Principal{Name: "sis", Roles: []string{"calendar", "registrar"}}); role != "registrar" {
+		t.Errorf("registrar principal has role %v", role)
+	}
+	if fields := policy.VisibleFields("public", []string{"dob", "email"}); len(fields) != 0 {
+		t.Errorf("public role should not see %v", fields)
+	}
+
+	var b strings.Builder
+	s := Student{Number: "1", FirstName: "Ann", LastName: "Lee", Room: "01A", Username: "alee", DOB: "2008-01-02"}
+	enc := policy.NewEncoder(&b, "public", "10.0.0.2", []string{"dob"})
+	enc.Apply(&s)
+	expected := Student{Number: "1", LastName: "Lee", Room: Redacted, DOB: Redacted}
+	if s != expected {
+		t.Errorf("public student: expected %+v, got %+v", expected, s)
+	}
+
+	s = Student{Number: "1", DOB: "2008-01-02"}
+	enc = policy.NewEncoder(&b, "registrar", "10.0.0.1", []string{"dob"})
+	enc.Apply(&s)
+	if s.DOB != "2008-01-02" || enc.revealed["dob"] != 1 {
+		t.Errorf("registrar should see dob, got %+v", s)
+	}
+}
+
+func TestWriteStudentsTabular(t *testing.T) {
+	students := func() <-chan Student {
+		ch := make(chan Student, 2)
+		ch <- Student{Number: "1", FirstName: "Ann", LastName: "Lee", GradeLevel: "11"}
+		ch <- Student{Number: "2", FirstName: "Bo, Jr.", LastName: "Ng & Co", GradeLevel: "12"}
+		close(ch)
+		return ch
+	}
+	columns := []string{"last_name", "grade_level", "first_name"}
+	if fields, err := CheckStudentColumns(columns); err != nil || len(fields) != 1 || fields[0] != "grade_level" {
+		t.Errorf("CheckStudentColumns: %v, %v", fields, err)
+	}
+
+	var csv strings.Builder
+	if err := WriteStudentsCSV(&csv, students(), columns); err != nil {
+		t.Fatal(err)
+	}
+	expected := "last_name,grade_level,first_name\nLee,11,Ann\nNg & Co,12,\"Bo, Jr.\"\n"
+	if csv.String() != expected {
+		t.Errorf("CSV: expected %q, got %q", expected, csv.String())
+	}
+
+	var xlsx bytes.Buffer
+	if err := WriteStudentsXLSX(&xlsx, students(), columns); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(xlsx.Bytes()), int64(xlsx.Len()))
+	if err != nil {
+		t.Fatalf("XLSX is not a zip file: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		var sheet struct {
+			Rows []struct {
+				Cells []string `xml:"c>is>t"`
+			} `xml:"sheetData>row"`
+		}
+		if err := xml.NewDecoder(rc).Decode(&sheet); err != nil {
+			t.Fatalf("sheet XML: %v", err)
+		}
+		if len(sheet.Rows) != 3 || strings.Join(sheet.Rows[2].Cells, "|") != "Ng & Co|12|Bo, Jr." {
+			t.Errorf("unexpected sheet rows %+v", sheet.Rows)
+		}
+		return
+	}
+	t.Errorf("XLSX has no sheet1.xml")
+}
@@ -12,18 +12,26 @@ import (
 // Meeting holds all PowerSchool data for a single teacher schedule
 // event, a course meeting.
 type Meeting struct {
-	loginid       string
-	start         time.Time
-	duration      int
-	courseName    string
-	courseNumber  string
-	sectionNumber string
-	room          string
+	LoginID       string    `json:"loginid"`
+	Start         time.Time `json:"start"`
+	Duration      int       `json:"duration"` // minutes
+	CourseName    string    `json:"course_name"`
+	CourseNumber  string    `json:"course_number"`
+	SectionNumber string    `json:"section_number"`
+	SectionID     int       `json:"section_id"`
+	Room          string    `json:"room"`
+	TermID        int       `json:"term_id"`
+	Term          string    `json:"term"`         // term abbreviation, e.g. "S1"
+	PeriodStart   int       `json:"period_start"` // first period number of the meeting
+	PeriodEnd     int       `json:"period_end"`   // last period number of the meeting
+	CycleDay      string    `json:"cycle_day"`
+	BellSchedule  string    `json:"bell_schedule"`
 }
 
-// GetTeacherSched returns a channel of Meeting items for the given teacher username.
-func GetTeacherSched(db *sql.DB, name string) <-chan Meeting {
-	query := `
+// teacherSchedQuery is the query of the meetings of the teachers whose
+// loginids match the :loginid bind, with the meeting filter as its second
+// argument.
+const teacherSchedQuery = `
     with
     sm1 as (select sm.sectionid, sm.cycle_day_letter, min(sm.period_number) period_min from section_meeting sm group by sectionid, cycle_day_letter),
     sm2 as (select sm.sectionid, sm.cycle_day_letter, max(sm.period_number) period_max from section_meeting sm group by sectionid, cycle_day_letter)
@@ -36,7 +44,14 @@ func GetTeacherSched(db *sql.DB, name string) <-chan Meeting {
     courses.course_name,
     s.course_number,
     s.section_number,
-    s.room
+    s.room,
+    s.id,
+    terms.id,
+    terms.abbreviation,
+    sm1.period_min,
+    sm2.period_max,
+    sm1.cycle_day_letter,
+    bs.name
     from sections s
 
     join sectionteacher on s.id = sectionteacher.sectionid
@@ -54,25 +69,36 @@ func GetTeacherSched(db *sql.DB, name string) <-chan Meeting {
     -- up to here we've got one row per section meeting:  e.g. MAT321-1 A(13-15)
     join calendar_day cd on cd.schoolid = s.schoolid and cd.date_value between terms.firstday and terms.lastday and cd.cycle_day_id = cycle_day.id
     -- now we've matched the section meetings against each calendar day they could meet (if bell sched allows)
+    join bell_schedule bs on cd.bell_schedule_id = bs.id
     join bell_schedule_items bsi1 on period1.id = bsi1.period_id and cd.bell_schedule_id = bsi1.bell_schedule_id
     join bell_schedule_items bsi2 on period2.id = bsi2.period_id and cd.bell_schedule_id = bsi2.bell_schedule_id
     -- matched against bell schedule to determine if that day has the periods, and get the actual period times
     where
     s.schoolid = 140177
     and terms.yearid = :yearid
-    and teachers.loginid = :loginid
-    and period1.period_number < 21
-    and s.course_number not in ('SLD100', 'SLD102', 'SLD200', 'SLD210', 'SLD600')  -- Res Life, LASSI, Nav, LEAD, I-Day Attendance
+    and teachers.loginid %s :loginid
+    and %s
     and teachers.loginid is not null  -- ignore placeholders like "Staff, New"
     and cd.date_value between sectionteacher.start_date and sectionteacher.end_date
     order by teachers.loginid, cd.date_value, sm1.period_min
 `
-	return GetPSMeetings(db, query, name)
+
+// GetTeacherSched returns a channel of Meeting items for the given teacher username.
+func GetTeacherSched(db *sql.DB, name string) <-chan Meeting {
+	filter, args := rules.meetingFilter(3)
+	return GetPSMeetings(db, fmt.Sprintf(teacherSchedQuery, "=", filter), name, args...)
 }
 
-// GetRoomSched returns a channel of Meeting values for the given teacher account name
-func GetRoomSched(db *sql.DB, name string) <-chan Meeting {
-	query := `
+// GetAllTeacherSched returns a channel of the Meeting values of every
+// teacher, ordered by loginid.
+func GetAllTeacherSched(db *sql.DB) <-chan Meeting {
+	filter, args := rules.meetingFilter(3)
+	return GetPSMeetings(db, fmt.Sprintf(teacherSchedQuery, "like", filter), "%", args...)
+}
+
+// roomSchedQuery is the query of the meetings in the rooms matching the
+// :room bind, with the meeting filter as its second argument.
+const roomSchedQuery = `
     with
     sm1 as (select sm.sectionid, sm.cycle_day_letter, min(sm.period_number) period_min from section_meeting sm group by sectionid, cycle_day_letter),
     sm2 as (select sm.sectionid, sm.cycle_day_letter, max(sm.period_number) period_max from section_meeting sm group by sectionid, cycle_day_letter)
@@ -85,7 +111,14 @@ func GetRoomSched(db *sql.DB, name string) <-chan Meeting {
     courses.course_name,
     s.course_number,
     s.section_number,
-    s.room
+    s.room,
+    s.id,
+    terms.id,
+    terms.abbreviation,
+    sm1.period_min,
+    sm2.period_max,
+    sm1.cycle_day_letter,
+    bs.name
     from sections s
     join teachers on s.teacher = teachers.id
     join courses on s.course_number = courses.course_number
@@ -98,30 +131,96 @@ func GetRoomSched(db *sql.DB, name string) <-chan Meeting {
     -- up to here we've got one row per section meeting:  e.g. MAT321-1 A(13-15)
     join calendar_day cd on cd.schoolid = s.schoolid and cd.date_value between terms.firstday and terms.lastday and cd.cycle_day_id = cycle_day.id
     -- now we've matched the section meetings against each calendar day they could meet (if bell sched allows)
+    join bell_schedule bs on cd.bell_schedule_id = bs.id
     join bell_schedule_items bsi1 on period1.id = bsi1.period_id and cd.bell_schedule_id = bsi1.bell_schedule_id
     join bell_schedule_items bsi2 on period2.id = bsi2.period_id and cd.bell_schedule_id = bsi2.bell_schedule_id
     -- matched against bell schedule to determine if that day has the periods, and get the actual period times
     where
     s.schoolid = 140177
     and terms.yearid = :yearid
-    and s.room = :room
-    and period1.period_number < 21
-    and s.course_number not in ('SLD100', 'SLD102', 'SLD210', 'SLD600')  -- Res Life, LASSI, LEAD, I-Day Attendance
+    and s.room %s :room
+    and %s
     and teachers.loginid is not null  -- ignore placeholders like "Staff, New"
     order by teachers.loginid, cd.date_value, sm1.period_min
 `
-	return GetPSMeetings(db, query, name)
+
+// GetRoomSched returns a channel of Meeting values for the given room
+func GetRoomSched(db *sql.DB, name string) <-chan Meeting {
+	filter, args := rules.meetingFilter(3)
+	return GetPSMeetings(db, fmt.Sprintf(roomSchedQuery, "=", filter), name, args...)
+}
+
+// GetAllRoomSched returns a channel of the Meeting values of every room.
+func GetAllRoomSched(db *sql.DB) <-chan Meeting {
+	filter, args := rules.meetingFilter(3)
+	return GetPSMeetings(db, fmt.Sprintf(roomSchedQuery, "like", filter), "%", args...)
+}
+
+// GetStudentSched returns a channel of Meeting values for the classes in
+// which the student with the given student number is enrolled.
+func GetStudentSched(db *sql.DB, number string) <-chan Meeting {
+	filter, args := rules.meetingFilter(3)
+	query := fmt.Sprintf(`
+    with
+    sm1 as (select sm.sectionid, sm.cycle_day_letter, min(sm.period_number) period_min from section_meeting sm group by sectionid, cycle_day_letter),
+    sm2 as (select sm.sectionid, sm.cycle_day_letter, max(sm.period_number) period_max from section_meeting sm group by sectionid, cycle_day_letter)
+    select
+    teachers.loginid,
+    to_char(cd.date_value, 'YYYYMMDD') "date",
+    to_char(floor(bsi1.start_time/3600), 'FM09')
+    || to_char(floor(mod(bsi1.start_time, 3600) / 60), 'FM09') "start", -- HHMM
+    floor((bsi2.end_time - bsi1.start_time) / 60) duration, -- minutes
+    courses.course_name,
+    s.course_number,
+    s.section_number,
+    s.room,
+    s.id,
+    terms.id,
+    terms.abbreviation,
+    sm1.period_min,
+    sm2.period_max,
+    sm1.cycle_day_letter,
+    bs.name
+    from sections s
+    join cc on cc.sectionid = s.id  -- dropped enrollments have a negated sectionid
+    join students on cc.studentid = students.id
+    join teachers on s.teacher = teachers.id
+    join courses on s.course_number = courses.course_number
+    join sm1 on s.id = sm1.sectionid
+    join sm2 on s.id = sm2.sectionid and sm1.cycle_day_letter = sm2.cycle_day_letter
+    join terms on s.termid = terms.id and s.schoolid = terms.schoolid
+    join period period1 on sm1.period_min = period1.period_number and s.schoolid = period1.schoolid and terms.yearid = period1.year_id
+    join period period2 on sm2.period_max = period2.period_number and s.schoolid = period2.schoolid and terms.yearid = period2.year_id
+    join cycle_day on sm1.cycle_day_letter = cycle_day.letter and terms.yearid = cycle_day.year_id and cycle_day.schoolid = terms.schoolid
+    -- up to here we've got one row per section meeting:  e.g. MAT321-1 A(13-15)
+    join calendar_day cd on cd.schoolid = s.schoolid and cd.date_value between terms.firstday and terms.lastday and cd.cycle_day_id = cycle_day.id
+    -- now we've matched the section meetings against each calendar day they could meet (if bell sched allows)
+    join bell_schedule bs on cd.bell_schedule_id = bs.id
+    join bell_schedule_items bsi1 on period1.id = bsi1.period_id and cd.bell_schedule_id = bsi1.bell_schedule_id
+    join bell_schedule_items bsi2 on period2.id = bsi2.period_id and cd.bell_schedule_id = bsi2.bell_schedule_id
+    -- matched against bell schedule to determine if that day has the periods, and get the actual period times
+    where
+    s.schoolid = 140177
+    and terms.yearid = :yearid
+    and students.student_number = :student_number
+    and %s
+    and teachers.loginid is not null  -- ignore placeholders like "Staff, New"
+    and cd.date_value >= cc.dateenrolled and cd.date_value < cc.dateleft
+    order by cd.date_value, sm1.period_min
+`, filter)
+	return GetPSMeetings(db, query, number, args...)
 }
 
 // GetPSMeetings runs the given query and returns a channel of Meeting values.
 // Several different queries can use this same processing to generated the Meeting data.
-func GetPSMeetings(db *sql.DB, query string, name string) <-chan Meeting {
-	yearid := getYearid()
+// The query binds the year id and name first, followed by any additional args.
+func GetPSMeetings(db *sql.DB, query string, name string, args ...interface{}) <-chan Meeting {
+	yearid := CurrentYearID(db)
 	if os.Getenv("TEACHER_SCHED_DEBUG") != "" {
-		log.Printf("yearid=%v, name=%v, query=%v", yearid, name, query)
+		log.Printf("yearid=%v, name=%v, args=%v, query=%v", yearid, name, args, query)
 	}
 
-	rows, err := db.Query(query, yearid, name)
+	rows, err := db.Query(query, append([]interface{}{yearid, name}, args...)...)
 	if err != nil {
 		log.Panicf("query failed: %v", err)
 	}
@@ -138,15 +237,18 @@ func GetPSMeetings(db *sql.DB, query string, name string) <-chan Meeting {
 		}
 		for rows.Next() {
 			m := Meeting{}
-			var loginid, room sql.NullString
-			err = rows.Scan(&loginid, &date, &start, &m.duration, &m.courseName, &m.courseNumber, &m.sectionNumber, &room)
+			var loginid, room, term, bellSched sql.NullString
+			err = rows.Scan(&loginid, &date, &start, &m.Duration, &m.CourseName, &m.CourseNumber, &m.SectionNumber, &room,
+				&m.SectionID, &m.TermID, &term, &m.PeriodStart, &m.PeriodEnd, &m.CycleDay, &bellSched)
 			if err != nil {
 				log.Panicf("%v, name = '%v'", err, name)
 			}
-			m.loginid = emptyifnull(loginid)
-			m.room = emptyifnull(room)
+			m.LoginID = emptyifnull(loginid)
+			m.Room = emptyifnull(room)
+			m.Term = emptyifnull(term)
+			m.BellSchedule = emptyifnull(bellSched)
 			datetimestr := date + start
-			m.start, err = time.ParseInLocation("200601021504", datetimestr, loc)
+			m.Start, err = time.ParseInLocation("200601021504", datetimestr, loc)
 			if err != nil {
 				log.Panicf("time.Parse(): %v", err)
 			}
@@ -159,88 +261,15 @@ func GetPSMeetings(db *sql.DB, query string, name string) <-chan Meeting {
 }
 
 // TeacherCalendar returns the iCalendar for the class meetings for the given teacher
+//
+// Deprecated: use WriteICalendar with TeacherFeed, which does not hold the calendar in memory.
 func TeacherCalendar(db *sql.DB, loginid string) *ical.Component {
-	ch := GetTeacherSched(db, loginid)
-	cal := ical.Component{}
-	cal.SetName("VCALENDAR")
-	cal.Set("VERSION", ical.VString("2.0"))
-	cal.Set("PRODID", ical.VStringf("-//imsa.edu//powerschool calendar for %s//EN", loginid))
-	cal.Set("METHOD", ical.VString("PUBLISH"))
-	cal.Set("CALSCALE", ical.VString("GREGORIAN"))
-	cal.Set("x-wr-calname", ical.VStringf("%s@imsa.edu PowerSchool", loginid))
-	cal.Set("x-wr-caldesc", ical.VStringf("IMSA PowerSchool teacher calendar for %s", loginid))
-	cal.Set("x-wrt-timezone", ical.VString("America/Chicago"))
-	vtimezone := calTimezone()
-	cal.AddComponent(&vtimezone)
-
-	dateStamp := time.Now().Format("2006-01-02T15:04")
-
-	for mtg := range ch {
-		e := ical.Component{}
-		e.SetName("VEVENT")
-		dtstart := ical.VDateTime(mtg.start)
-		e.Set("DTSTART", dtstart)
-		e.Set("DTEND", ical.VDateTime(mtg.start.Add(time.Duration(mtg.duration)*time.Minute)))
-		//e.Set("DURATION", ical.VDuration(time.Duration(mtg.duration)*time.Minute))
-		e.Set("SUMMARY", ical.VString(mtg.courseName))
-		e.Set("DESCRIPTION", ical.VString(fmt.Sprintf("%s (%s-%s) -- %s\n\n#pscal_generated %s",
-			mtg.courseName, mtg.courseNumber, mtg.sectionNumber, mtg.room, dateStamp)))
-		organizer := ical.NewProperty("ORGANIZER", ical.VString(fmt.Sprintf("mailto:%s@imsa.edu", mtg.loginid)))
-		//organizer.Add("CN", ical.VString("TODO-CN"))
-		e.AddProperty(&organizer)
-		e.Set("DTSTAMP", ical.VDateTime(time.Now()))
-		e.Set("UID", ical.VString(fmt.Sprintf("PS-%s-%s-%s@imsa.edu",
-			mtg.courseNumber, mtg.sectionNumber, dtstart.String())))
-		attendee := ical.NewProperty("ATTENDEE", ical.VString(fmt.Sprintf("mailto:%s@imsa.edu", mtg.loginid)))
-		attendee.Add("PARTSTAT", ical.VString("ACCEPTED"))
-		attendee.Add("ROLE", ical.VString("REQ-PARTICIPANT"))
-		//attendee.Add("CN", ical.VString("TODO-CN"))
-		// TODO: add attendee for room
-		e.AddProperty(&attendee)
-		cal.AddComponent(&e)
-	}
-	return &cal
+	return TeacherFeed(db, loginid).Component()
 }
 
 // RoomCalendar returns the iCalendar comprising the class meetings in the given room
+//
+// Deprecated: use WriteICalendar with RoomFeed.
 func RoomCalendar(db *sql.DB, room string) *ical.Component {
-	ch := GetRoomSched(db, room)
-	cal := ical.Component{}
-	cal.SetName("VCALENDAR")
-	cal.Set("VERSION", ical.VString("2.0"))
-	cal.Set("PRODID", ical.VStringf("-//imsa.edu//powerschool calendar for %s//EN", room))
-	cal.Set("METHOD", ical.VString("PUBLISH"))
-	cal.Set("CALSCALE", ical.VString("GREGORIAN"))
-	cal.Set("x-wr-calname", ical.VStringf("Room %s for PowerSchool", room))
-	cal.Set("x-wr-caldesc", ical.VStringf("IMSA PowerSchool room calendar for %s", room))
-	cal.Set("x-wrt-timezone", ical.VString("America/Chicago"))
-	vtimezone := calTimezone()
-	cal.AddComponent(&vtimezone)
-
-	dateStamp := time.Now().Format("2006-01-02T15:04")
-
-	for mtg := range ch {
-		e := ical.Component{}
-		e.SetName("VEVENT")
-		dtstart := ical.VDateTime(mtg.start)
-		e.Set("DTSTART", dtstart)
-		e.Set("DTEND", ical.VDateTime(mtg.start.Add(time.Duration(mtg.duration)*time.Minute)))
-		e.Set("SUMMARY", ical.VString(mtg.courseName))
-		e.Set("DESCRIPTION", ical.VString(fmt.Sprintf("%s (%s-%s) -- %s\n\n#pscal_generated %s",
-			mtg.courseName, mtg.courseNumber, mtg.sectionNumber, mtg.room, dateStamp)))
-		organizer := ical.NewProperty("ORGANIZER", ical.VString(fmt.Sprintf("mailto:%s@imsa.edu", mtg.loginid)))
-		//organizer.Add("CN", ical.VString("TODO-CN"))
-		e.AddProperty(&organizer)
-		e.Set("DTSTAMP", ical.VDateTime(time.Now()))
-		e.Set("UID", ical.VString(fmt.Sprintf("PS-%s-%d-%s@imsa.edu",
-			mtg.courseNumber, mtg.sectionNumber, dtstart.String())))
-		attendee := ical.NewProperty("ATTENDEE", ical.VString(fmt.Sprintf("mailto:%s@imsa.edu", mtg.loginid)))
-		attendee.Add("PARTSTAT", ical.VString("ACCEPTED"))
-		attendee.Add("ROLE", ical.VString("REQ-PARTICIPANT"))
-		//attendee.Add("CN", ical.VString("TODO-CN"))
-		// TODO: add attendee for room
-		e.AddProperty(&attendee)
-		cal.AddComponent(&e)
-	}
-	return &cal
+	return RoomFeed(db, room).Component()
 }
@@ -0,0 +1,88 @@
+package psfacade
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// Teacher is a staff member from the PowerSchool teachers table.
+type Teacher struct {
+	LoginID    string `json:"loginid"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Email      string `json:"email"`
+	Department string `json:"department"`
+	Active     bool   `json:"active"`
+}
+
+// Name returns the teacher's name as "First Last".
+func (t Teacher) Name() string {
+	return strings.TrimSpace(t.FirstName + " " + t.LastName)
+}
+
+// Matches reports whether the teacher's loginid, first name, last name or
+// full name starts with the prefix, ignoring case.
+func (t Teacher) Matches(prefix string) bool {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	for _, s := range []string{t.LoginID, t.FirstName, t.LastName, t.Name(), t.LastName + ", " + t.FirstName} {
+		if strings.HasPrefix(strings.ToLower(s), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTeachers returns a channel of the teachers with a loginid, ordered by
+// name.
+func GetTeachers(db *sql.DB) <-chan Teacher {
+	query := `
+select loginid, first_name, last_name, email_addr, sched_department, status
+from teachers
+where schoolid = 140177 and loginid is not null  -- ignore placeholders like "Staff, New"
+order by last_name, first_name, loginid
+`
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	teachers := make(chan Teacher)
+	go func() {
+		defer rows.Close()
+		defer close(teachers)
+		for rows.Next() {
+			t := Teacher{}
+			var first, last, email, department sql.NullString
+			var status int
+			if err := rows.Scan(&t.LoginID, &first, &last, &email, &department, &status); err != nil {
+				log.Panic("rows.Scan: ", err)
+			}
+			t.FirstName = emptyifnull(first)
+			t.LastName = emptyifnull(last)
+			t.Email = emptyifnull(email)
+			t.Department = emptyifnull(department)
+			t.Active = status == 1
+			teachers <- t
+		}
+		if err := rows.Err(); err != nil {
+			log.Panic("rows.Err ", err)
+		}
+	}()
+	return teachers
+}
+
+// FindTeachers returns the teachers that match the prefix, as by
+// Teacher.Matches, leaving out inactive ones unless includeInactive.
+func FindTeachers(db *sql.DB, prefix string, includeInactive bool) []Teacher {
+	return filterTeachers(GetTeachers(db), prefix, includeInactive)
+}
+
+func filterTeachers(teachers <-chan Teacher, prefix string, includeInactive bool) []Teacher {
+	var found []Teacher
+	for t := range teachers {
+		if (t.Active || includeInactive) && t.Matches(prefix) {
+			found = append(found, t)
+		}
+	}
+	return found
+}
@@ -0,0 +1,42 @@
+package psfacade
+
+import "testing"
+
+func TestFindTeachers(t *testing.T) {
+	teachers := func() <-chan Teacher {
+		ch := make(chan Teacher, 3)
+		ch <- Teacher{LoginID: "fogel", FirstName: "Fred", LastName: "Fogel", Active: true}
+		ch <- Teacher{LoginID: "jsmith", FirstName: "Jane", LastName: "Smith", Active: true}
+		ch <- Teacher{LoginID: "fsmith", FirstName: "Frank", LastName: "Smith"}
+		close(ch)
+		return ch
+	}
+	tests := []struct {
+		prefix   string
+		inactive bool
+		want     []string
+	}{
+		{"smi", false, []string{"jsmith"}},
+		{"smi", true, []string{"jsmith", "fsmith"}},
+		{"F", false, []string{"fogel"}},
+		{"jane s", false, []string{"jsmith"}},
+		{"Smith, F", true, []string{"fsmith"}},
+		{"x", true, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, teacher := range filterTeachers(teachers(), test.prefix, test.inactive) {
+			got = append(got, teacher.LoginID)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %v, expected %v", test.prefix, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: got %v, expected %v", test.prefix, got, test.want)
+				break
+			}
+		}
+	}
+}
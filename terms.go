@@ -0,0 +1,132 @@
+package psfacade
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Term is a PowerSchool term: the school year itself or a part of it such
+// as a semester or quarter.
+type Term struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Abbreviation string    `json:"abbreviation"`
+	FirstDay     time.Time `json:"firstday"`
+	LastDay      time.Time `json:"lastday"`
+	YearID       int       `json:"yearid"`
+	Portion      int       `json:"portion"`   // terms per year of this length: 1 for the year, 2 for a semester
+	Parent       int       `json:"parent_id"` // id of the term that holds this one, 0 for the year
+	Children     []int     `json:"children"`  // ids of the terms this one holds
+}
+
+// CurrentYearID returns the PowerSchool year id of the current school year:
+// that of the year term holding today or, between school years, of the one
+// that last began.
+func CurrentYearID(db *sql.DB) int {
+	query := `
+select yearid from (
+  select yearid from terms
+  where schoolid = 140177 and portion = 1 and firstday <= to_date(:today, 'YYYY-MM-DD')
+  order by firstday desc
+) where rownum = 1
+`
+	var yearid int
+	if err := db.QueryRow(query, time.Now().Format("2006-01-02")).Scan(&yearid); err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	return yearid
+}
+
+// Contains reports whether the date's calendar date is in the term.
+func (t Term) Contains(date time.Time) bool {
+	date = civilDate(date)
+	return !date.Before(t.FirstDay) && !date.After(t.LastDay)
+}
+
+// GetTerms returns the terms of the school year with the PowerSchool year
+// id, ordered from the longest down to the shortest and then by first day.
+func GetTerms(db *sql.DB, yearid int) []Term {
+	query := `
+select id, name, abbreviation, to_char(firstday, 'YYYY-MM-DD'), to_char(lastday, 'YYYY-MM-DD'), yearid, portion
+from terms
+where schoolid = 140177 and yearid = :yearid
+order by portion, firstday, id
+`
+	rows, err := db.Query(query, yearid)
+	if err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	defer rows.Close()
+	var terms []Term
+	for rows.Next() {
+		var t Term
+		var name, abbreviation sql.NullString
+		var firstday, lastday string
+		if err := rows.Scan(&t.ID, &name, &abbreviation, &firstday, &lastday, &t.YearID, &t.Portion); err != nil {
+			log.Panic("rows.Scan: ", err)
+		}
+		t.Name = emptyifnull(name)
+		t.Abbreviation = emptyifnull(abbreviation)
+		if t.FirstDay, err = time.Parse("2006-01-02", firstday); err != nil {
+			log.Panic("time.Parse ", err)
+		}
+		if t.LastDay, err = time.Parse("2006-01-02", lastday); err != nil {
+			log.Panic("time.Parse ", err)
+		}
+		terms = append(terms, t)
+	}
+	if err := rows.Err(); err != nil {
+		log.Panic("rows.Err ", err)
+	}
+	linkTerms(terms)
+	return terms
+}
+
+// linkTerms sets the parent and children of the terms, which are ordered as
+// by GetTerms. A term's parent is the shortest longer term that spans it.
+func linkTerms(terms []Term) {
+	for i := range terms {
+		for j := i - 1; j >= 0; j-- {
+			parent := &terms[j]
+			if parent.Portion < terms[i].Portion &&
+				!terms[i].FirstDay.Before(parent.FirstDay) && !terms[i].LastDay.After(parent.LastDay) {
+				terms[i].Parent = parent.ID
+				parent.Children = append(parent.Children, terms[i].ID)
+				break
+			}
+		}
+	}
+}
+
+// YearTerm returns the term spanning the whole school year among the terms,
+// or false if there is none.
+func YearTerm(terms []Term) (Term, bool) {
+	for _, t := range terms {
+		if t.Portion == 1 {
+			return t, true
+		}
+	}
+	return Term{}, false
+}
+
+// FindTerm returns the term with the abbreviation, such as "S1", or false
+// if there is none.
+func FindTerm(terms []Term, abbreviation string) (Term, bool) {
+	for _, t := range terms {
+		if t.Abbreviation == abbreviation {
+			return t, true
+		}
+	}
+	return Term{}, false
+}
+
+// currentYearTerm returns the year term of the current school year.
+func currentYearTerm(db *sql.DB) Term {
+	yearid := CurrentYearID(db)
+	year, ok := YearTerm(GetTerms(db, yearid))
+	if !ok {
+		log.Panicf("no year term for yearid %d", yearid)
+	}
+	return year
+}
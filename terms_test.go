@@ -0,0 +1,35 @@
+package psfacade
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLinkTerms(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		year := 2016
+		if month < 7 {
+			year++
+		}
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	terms := []Term{
+		{ID: 2600, Abbreviation: "16-17", Portion: 1, FirstDay: date(8, 15), LastDay: date(6, 2)},
+		{ID: 2601, Abbreviation: "S1", Portion: 2, FirstDay: date(8, 15), LastDay: date(12, 16)},
+		{ID: 2602, Abbreviation: "S2", Portion: 2, FirstDay: date(1, 3), LastDay: date(6, 2)},
+		{ID: 2603, Abbreviation: "Q1", Portion: 4, FirstDay: date(8, 15), LastDay: date(10, 14)},
+		{ID: 2606, Abbreviation: "Q4", Portion: 4, FirstDay: date(3, 27), LastDay: date(6, 2)},
+	}
+	linkTerms(terms)
+	got := fmt.Sprint(terms[0].Children, terms[1].Children, terms[2].Children, terms[3].Parent, terms[4].Parent)
+	if got != "[2601 2602] [2603] [2606] 2601 2602" {
+		t.Errorf("links are %s", got)
+	}
+	if year, ok := YearTerm(terms); !ok || year.ID != 2600 {
+		t.Errorf("YearTerm = %v, %v", year.ID, ok)
+	}
+	if s2, ok := FindTerm(terms, "S2"); !ok || !s2.Contains(time.Date(2017, 6, 2, 15, 0, 0, 0, time.Local)) {
+		t.Errorf("S2 = %v, %v", s2, ok)
+	}
+}
@@ -0,0 +1,201 @@
+package psfacade
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// UtilizationSlot is the use of a room in one period on one day of the
+// week over a term: the minutes of class meetings in it and the minutes
+// the bell schedules give the period on the days in session.
+type UtilizationSlot struct {
+	Weekday     string  `json:"weekday"` // e.g. "Mon"
+	Period      int     `json:"period"`
+	Scheduled   int     `json:"scheduled_minutes"`
+	Available   int     `json:"available_minutes"`
+	Utilization float64 `json:"utilization"` // Scheduled / Available, over 1 if meetings overlap
+}
+
+// RoomUtilization is the use of a room over a term, in total and by slot.
+type RoomUtilization struct {
+	Room        string            `json:"room"`
+	Scheduled   int               `json:"scheduled_minutes"`
+	Available   int               `json:"available_minutes"`
+	Utilization float64           `json:"utilization"`
+	Slots       []UtilizationSlot `json:"slots"`
+}
+
+// UtilizationReport is the use of every room with sections this year over
+// a term, including rooms with no class meetings in it.
+type UtilizationReport struct {
+	Term  string            `json:"term"`
+	From  time.Time         `json:"from"`
+	To    time.Time         `json:"to"` // last day
+	Rooms []RoomUtilization `json:"rooms"`
+}
+
+// slotKey identifies a period on a day of the week.
+type slotKey struct {
+	weekday time.Weekday
+	period  int
+}
+
+// ratio returns scheduled/available, or 0 if nothing is available.
+func ratio(scheduled, available int) float64 {
+	if available == 0 {
+		return 0
+	}
+	return float64(scheduled) / float64(available)
+}
+
+// overlapMinutes returns the minutes that [start1, end1) and [start2, end2) share.
+func overlapMinutes(start1, end1, start2, end2 time.Time) int {
+	if start2.After(start1) {
+		start1 = start2
+	}
+	if end2.Before(end1) {
+		end1 = end2
+	}
+	if !end1.After(start1) {
+		return 0
+	}
+	return int(end1.Sub(start1) / time.Minute)
+}
+
+// GetRoomUtilization returns the UtilizationReport of the term of this
+// school year with the abbreviation, or false if there is no such term.
+func GetRoomUtilization(db *sql.DB, abbreviation string) (UtilizationReport, bool) {
+	term, ok := FindTerm(GetTerms(db, CurrentYearID(db)), abbreviation)
+	if !ok {
+		return UtilizationReport{}, false
+	}
+	rooms, err := GetRoomNames(db)
+	if err != nil {
+		log.Panicf("query failed: %v", err)
+	}
+	schedules := getBellSchedules(db, term.FirstDay, term.LastDay, " and cd.insession = 1")
+	return RoomUtilizationReport(term, schedules, rooms, GetAllRoomSched(db)), true
+}
+
+// RoomUtilizationReport computes the use of the rooms by the meetings during
+// the term, whose days in session have the bell schedules. It reads all of
+// the meetings, counting only the minutes within bell schedule periods.
+// It reports each of the rooms, with no scheduled minutes if no meetings
+// use it, along with any other rooms the meetings use.
+func RoomUtilizationReport(term Term, schedules []BellSchedule, rooms []string, meetings <-chan Meeting) UtilizationReport {
+	report := UtilizationReport{Term: term.Abbreviation, From: term.FirstDay, To: term.LastDay}
+	byDate := map[time.Time]BellSchedule{}
+	available := map[slotKey]int{}
+	for _, sched := range schedules {
+		if !term.Contains(sched.Date) {
+			continue
+		}
+		byDate[sched.Date] = sched
+		for _, p := range sched.Periods {
+			available[slotKey{sched.Date.Weekday(), p.Number}] += int(p.End.Sub(p.Start) / time.Minute)
+		}
+	}
+
+	scheduled := map[string]map[slotKey]int{}
+	for _, room := range rooms {
+		scheduled[room] = map[slotKey]int{}
+	}
+	for m := range meetings {
+		sched, ok := byDate[civilDate(m.Start)]
+		if !ok || m.Room == "" {
+			continue
+		}
+		if scheduled[m.Room] == nil {
+			scheduled[m.Room] = map[slotKey]int{}
+		}
+		for _, p := range sched.Periods {
+			if minutes := overlapMinutes(m.Start, m.End(), p.Start, p.End); minutes > 0 {
+				scheduled[m.Room][slotKey{sched.Date.Weekday(), p.Number}] += minutes
+			}
+		}
+	}
+
+	keys := make([]slotKey, 0, len(available))
+	for key := range available {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].weekday != keys[j].weekday {
+			return keys[i].weekday < keys[j].weekday
+		}
+		return keys[i].period < keys[j].period
+	})
+	for room, minutes := range scheduled {
+		ru := RoomUtilization{Room: room}
+		for _, key := range keys {
+			slot := UtilizationSlot{
+				Weekday:   key.weekday.String()[:3],
+				Period:    key.period,
+				Scheduled: minutes[key],
+				Available: available[key],
+			}
+			slot.Utilization = ratio(slot.Scheduled, slot.Available)
+			ru.Slots = append(ru.Slots, slot)
+			ru.Scheduled += slot.Scheduled
+			ru.Available += slot.Available
+		}
+		ru.Utilization = ratio(ru.Scheduled, ru.Available)
+		report.Rooms = append(report.Rooms, ru)
+	}
+	sort.Slice(report.Rooms, func(i, j int) bool { return report.Rooms[i].Room < report.Rooms[j].Room })
+	return report
+}
+
+// UtilizationMatrix is a UtilizationReport as a table for a heat map: a
+// row for each room, a column for each slot and the utilization in each cell.
+type UtilizationMatrix struct {
+	Term    string      `json:"term"`
+	Rows    []string    `json:"rows"`    // rooms
+	Columns []string    `json:"columns"` // slots, e.g. "Mon 3"
+	Values  [][]float64 `json:"values"`  // by row, then column
+}
+
+// Matrix returns the report as a UtilizationMatrix.
+func (r UtilizationReport) Matrix() UtilizationMatrix {
+	m := UtilizationMatrix{Term: r.Term, Rows: []string{}, Columns: []string{}, Values: [][]float64{}}
+	for i, ru := range r.Rooms {
+		m.Rows = append(m.Rows, ru.Room)
+		values := make([]float64, len(ru.Slots))
+		for j, slot := range ru.Slots {
+			if i == 0 {
+				m.Columns = append(m.Columns, fmt.Sprintf("%s %d", slot.Weekday, slot.Period))
+			}
+			values[j] = slot.Utilization
+		}
+		m.Values = append(m.Values, values)
+	}
+	return m
+}
+
+// WriteUtilizationCSV writes the report to w as CSV with a header row and a
+// row for each room and slot.
+func WriteUtilizationCSV(w io.Writer, r UtilizationReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"term", "room", "weekday", "period", "scheduled_minutes", "available_minutes", "utilization"})
+	for _, ru := range r.Rooms {
+		for _, slot := range ru.Slots {
+			cw.Write([]string{
+				r.Term,
+				ru.Room,
+				slot.Weekday,
+				strconv.Itoa(slot.Period),
+				strconv.Itoa(slot.Scheduled),
+				strconv.Itoa(slot.Available),
+				strconv.FormatFloat(slot.Utilization, 'f', 3, 64),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
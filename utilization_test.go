@@ -0,0 +1,60 @@
+package psfacade
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomUtilizationReport(t *testing.T) {
+	loc, err := time.LoadLocation(calTimezoneID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time { return time.Date(2016, 9, day, hour, minute, 0, 0, loc) }
+	schedule := func(day int) BellSchedule {
+		return BellSchedule{Date: time.Date(2016, 9, day, 0, 0, 0, 0, time.UTC), Periods: []BellPeriod{
+			{Number: 1, Start: at(day, 8, 0), End: at(day, 8, 50)},
+			{Number: 2, Start: at(day, 9, 0), End: at(day, 9, 50)},
+		}}
+	}
+	// Monday the 12th and 19th, Tuesday the 13th
+	schedules := []BellSchedule{schedule(12), schedule(13), schedule(19)}
+	term := Term{Abbreviation: "S1", FirstDay: time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC), LastDay: time.Date(2016, 12, 16, 0, 0, 0, 0, time.UTC)}
+
+	meetings := make(chan Meeting, 4)
+	meetings <- Meeting{Room: "A113", Start: at(12, 8, 0), Duration: 110} // both periods and the passing time
+	meetings <- Meeting{Room: "A113", Start: at(19, 8, 0), Duration: 50}
+	meetings <- Meeting{Room: "B101", Start: at(13, 9, 0), Duration: 50}
+	meetings <- Meeting{Room: "B101", Start: at(14, 9, 0), Duration: 50} // no bell schedule that day
+	close(meetings)
+
+	report := RoomUtilizationReport(term, schedules, []string{"A113", "C200"}, meetings)
+	if len(report.Rooms) != 3 || report.Rooms[0].Room != "A113" || report.Rooms[1].Room != "B101" || report.Rooms[2].Room != "C200" {
+		t.Fatalf("rooms are %+v", report.Rooms)
+	}
+	a113 := report.Rooms[0]
+	if a113.Scheduled != 150 || a113.Available != 300 || a113.Utilization != 0.5 {
+		t.Errorf("A113: %d of %d minutes, %v", a113.Scheduled, a113.Available, a113.Utilization)
+	}
+	if idle := report.Rooms[2]; idle.Scheduled != 0 || idle.Available != 300 || idle.Utilization != 0 || len(idle.Slots) != 4 {
+		t.Errorf("idle C200: %+v", idle)
+	}
+	if slot := a113.Slots[0]; slot.Weekday != "Mon" || slot.Period != 1 || slot.Scheduled != 100 || slot.Utilization != 1 {
+		t.Errorf("A113 Mon 1: %+v", slot)
+	}
+
+	m := report.Matrix()
+	if strings.Join(m.Columns, ",") != "Mon 1,Mon 2,Tue 1,Tue 2" || m.Values[1][3] != 1 || m.Values[1][0] != 0 {
+		t.Errorf("matrix: %+v", m)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteUtilizationCSV(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "S1,A113,Mon,2,50,100,0.500\n") {
+		t.Errorf("CSV:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+package psfacade
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// blockGap is the longest break between two meetings that still leaves
+// them in one teaching block, long enough for the passing time between
+// periods.
+const blockGap = 15 * time.Minute
+
+// Workload is the teaching load of a teacher over a term.
+type Workload struct {
+	LoginID      string  `json:"loginid"`
+	Department   string  `json:"department"`
+	ContactHours float64 `json:"contact_hours"`  // over the term
+	HoursPerWeek float64 `json:"hours_per_week"` // averaged over the term's weeks of classes
+	MaxWeekHours float64 `json:"max_week_hours"`
+	Preps        int     `json:"preps"` // distinct courses
+	Sections     int     `json:"sections"`
+	LongestBlock int     `json:"longest_block_minutes"` // of meetings with no break over blockGap
+}
+
+// GetTeacherWorkload returns the workloads of the teachers during the term
+// of this school year with the abbreviation, or false if there is no such
+// term.
+func GetTeacherWorkload(db *sql.DB, abbreviation string) ([]Workload, bool) {
+	term, ok := FindTerm(GetTerms(db, CurrentYearID(db)), abbreviation)
+	if !ok {
+		return nil, false
+	}
+	workloads := TeacherWorkloads(term, GetAllTeacherSched(db))
+	departments := map[string]string{}
+	for t := range GetTeachers(db) {
+		departments[t.LoginID] = t.Department
+	}
+	for i := range workloads {
+		workloads[i].Department = departments[workloads[i].LoginID]
+	}
+	return workloads, true
+}
+
+// weekOf returns the Monday of the week of t's calendar date.
+func weekOf(t time.Time) time.Time {
+	date := civilDate(t)
+	return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+}
+
+// TeacherWorkloads computes the workload of each teacher from the meetings
+// during the term, reading all of the meetings. The weeks of the term are
+// those in which any of the meetings fall.
+func TeacherWorkloads(term Term, meetings <-chan Meeting) []Workload {
+	byTeacher := map[string][]Meeting{}
+	weeks := map[time.Time]bool{}
+	for m := range meetings {
+		if m.LoginID == "" || !term.Contains(m.Start) {
+			continue
+		}
+		byTeacher[m.LoginID] = append(byTeacher[m.LoginID], m)
+		weeks[weekOf(m.Start)] = true
+	}
+
+	var workloads []Workload
+	for loginid, mtgs := range byTeacher {
+		sort.SliceStable(mtgs, func(i, j int) bool { return mtgs[i].Start.Before(mtgs[j].Start) })
+		wl := Workload{LoginID: loginid}
+		courses, sections := map[string]bool{}, map[int]bool{}
+		weekMinutes := map[time.Time]int{}
+		minutes := 0
+		var blockStart, blockEnd time.Time
+		for _, m := range mtgs {
+			minutes += m.Duration
+			weekMinutes[weekOf(m.Start)] += m.Duration
+			courses[m.CourseNumber] = true
+			sections[m.SectionID] = true
+			newBlock := blockEnd.IsZero() || !civilDate(m.Start).Equal(civilDate(blockEnd)) ||
+				m.Start.Sub(blockEnd) > blockGap
+			if newBlock {
+				blockStart, blockEnd = m.Start, m.End()
+			} else if m.End().After(blockEnd) {
+				blockEnd = m.End()
+			}
+			if block := int(blockEnd.Sub(blockStart) / time.Minute); block > wl.LongestBlock {
+				wl.LongestBlock = block
+			}
+		}
+		wl.ContactHours = float64(minutes) / 60
+		wl.HoursPerWeek = wl.ContactHours / float64(len(weeks))
+		for _, m := range weekMinutes {
+			if hours := float64(m) / 60; hours > wl.MaxWeekHours {
+				wl.MaxWeekHours = hours
+			}
+		}
+		wl.Preps = len(courses)
+		wl.Sections = len(sections)
+		workloads = append(workloads, wl)
+	}
+	sort.Slice(workloads, func(i, j int) bool { return workloads[i].LoginID < workloads[j].LoginID })
+	return workloads
+}
+
+// WriteWorkloadCSV writes the workloads to w as CSV with a header row.
+func WriteWorkloadCSV(w io.Writer, workloads []Workload) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"loginid", "department", "contact_hours", "hours_per_week", "max_week_hours",
+		"preps", "sections", "longest_block_minutes"})
+	hours := func(h float64) string { return strconv.FormatFloat(h, 'f', 2, 64) }
+	for _, wl := range workloads {
+		cw.Write([]string{
+			wl.LoginID,
+			wl.Department,
+			hours(wl.ContactHours),
+			hours(wl.HoursPerWeek),
+			hours(wl.MaxWeekHours),
+			strconv.Itoa(wl.Preps),
+			strconv.Itoa(wl.Sections),
+			strconv.Itoa(wl.LongestBlock),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
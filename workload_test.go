@@ -0,0 +1,50 @@
+package psfacade
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeacherWorkloads(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2016, 9, day, hour, minute, 0, 0, time.UTC) }
+	term := Term{Abbreviation: "S1", FirstDay: at(1, 0, 0), LastDay: at(30, 0, 0)}
+
+	meetings := make(chan Meeting, 8)
+	// Monday the 12th: 8:00-8:50, 9:00-9:50 and 10:00-11:15 make one block; 13:00 starts another
+	meetings <- Meeting{LoginID: "fogel", CourseNumber: "MAT321", SectionID: 1, Start: at(12, 8, 0), Duration: 50}
+	meetings <- Meeting{LoginID: "fogel", CourseNumber: "MAT321", SectionID: 2, Start: at(12, 9, 0), Duration: 50}
+	meetings <- Meeting{LoginID: "fogel", CourseNumber: "MAT400", SectionID: 3, Start: at(12, 10, 0), Duration: 75}
+	meetings <- Meeting{LoginID: "fogel", CourseNumber: "MAT400", SectionID: 3, Start: at(12, 13, 0), Duration: 50}
+	// the next week
+	meetings <- Meeting{LoginID: "fogel", CourseNumber: "MAT321", SectionID: 1, Start: at(19, 8, 0), Duration: 45}
+	meetings <- Meeting{LoginID: "smith", CourseNumber: "CHE101", SectionID: 4, Start: at(20, 8, 0), Duration: 60}
+	meetings <- Meeting{LoginID: "smith", CourseNumber: "CHE101", SectionID: 4, Start: at(20, 9, 20), Duration: 60}
+	// outside the term
+	meetings <- Meeting{LoginID: "smith", CourseNumber: "CHE101", SectionID: 4, Start: time.Date(2016, 10, 3, 8, 0, 0, 0, time.UTC), Duration: 60}
+	close(meetings)
+
+	workloads := TeacherWorkloads(term, meetings)
+	if len(workloads) != 2 {
+		t.Fatalf("workloads: %+v", workloads)
+	}
+	fogel, smith := workloads[0], workloads[1]
+	if fogel.LoginID != "fogel" || fogel.ContactHours != 4.5 || fogel.HoursPerWeek != 2.25 || fogel.MaxWeekHours != 3.75 {
+		t.Errorf("fogel hours: %+v", fogel)
+	}
+	if fogel.Preps != 2 || fogel.Sections != 3 || fogel.LongestBlock != 195 {
+		t.Errorf("fogel load: %+v", fogel)
+	}
+	if smith.ContactHours != 2 || smith.Preps != 1 || smith.Sections != 1 || smith.LongestBlock != 60 {
+		t.Errorf("smith: %+v", smith)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWorkloadCSV(&buf, workloads); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "fogel,,4.50,2.25,3.75,2,3,195\n") {
+		t.Errorf("CSV:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,95 @@
+package psfacade
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// XLSXContentType is the MIME type of the files written by XLSXWriter.
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// XLSXWriter writes a single-sheet XLSX workbook of text cells, one row at a
+// time, without holding the sheet in memory.
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	err   error
+}
+
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// NewXLSXWriter starts a workbook on w whose one sheet has the given name.
+func NewXLSXWriter(w io.Writer, sheetName string) *XLSXWriter {
+	x := &XLSXWriter{zw: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		x.writePart(part.name, part.content)
+	}
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName))
+	x.writePart("xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="`+name.String()+`" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`)
+	if x.err == nil {
+		x.sheet, x.err = x.zw.Create("xl/worksheets/sheet1.xml")
+	}
+	x.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+func (x *XLSXWriter) writePart(name, content string) {
+	if x.err != nil {
+		return
+	}
+	var part io.Writer
+	part, x.err = x.zw.Create(name)
+	if x.err == nil {
+		_, x.err = io.WriteString(part, content)
+	}
+}
+
+func (x *XLSXWriter) write(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+// WriteRow adds a row of text cells to the sheet.
+func (x *XLSXWriter) WriteRow(cells []string) error {
+	x.write("<row>")
+	for _, cell := range cells {
+		var text strings.Builder
+		xml.EscapeText(&text, []byte(cell))
+		x.write(`<c t="inlineStr"><is><t xml:space="preserve">` + text.String() + `</t></is></c>`)
+	}
+	x.write("</row>")
+	return x.err
+}
+
+// Close finishes the sheet and the workbook. It does not close the underlying writer.
+func (x *XLSXWriter) Close() error {
+	x.write("</sheetData></worksheet>")
+	if x.err != nil {
+		return x.err
+	}
+	return x.zw.Close()
+}